@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	bundleConfigName   = "BundleConfig.pb"
+	bundleManifestPath = "manifest/AndroidManifest.xml"
+	bundleBaseModule   = "base"
+)
+
+func inspectAppBundle(bundlePath string) (*buildInfo, error) {
+	zr, err := zip.OpenReader(bundlePath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read app bundle at %q, error: %v", bundlePath, err)
+	}
+
+	defer zr.Close()
+
+	var baseManifest *zip.File
+
+	hasConfig := false
+	modules := []string{}
+
+	for _, file := range zr.File {
+		if file.Name == bundleConfigName {
+			hasConfig = true
+
+			continue
+		}
+
+		if module, ok := parseBundleModuleName(file.Name); ok {
+			modules = append(modules, module)
+
+			if module == bundleBaseModule {
+				baseManifest = file
+			}
+		}
+	}
+
+	if !hasConfig {
+		return nil, fmt.Errorf("App bundle at %q is missing %q", bundlePath, bundleConfigName)
+	}
+
+	if !slices.Contains(modules, bundleBaseModule) {
+		return nil, fmt.Errorf("App bundle at %q is missing %q", bundlePath, bundleBaseModule+"/"+bundleManifestPath)
+	}
+
+	data, err := readZipFile(baseManifest)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %q in app bundle at %q, error: %v", baseManifest.Name, bundlePath, err)
+	}
+
+	root, err := parseProtoXML(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %q in app bundle at %q, error: %v", baseManifest.Name, bundlePath, err)
+	}
+
+	am, err := extractAndroidManifest(root)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %q in app bundle at %q, error: %v", baseManifest.Name, bundlePath, err)
+	}
+
+	slices.Sort(modules)
+
+	return &buildInfo{
+		androidManifest: am,
+		bundleModules:   modules}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func parseBundleModuleName(name string) (string, bool) {
+	module, rest, found := strings.Cut(name, "/")
+
+	if !found || len(module) == 0 || rest != bundleManifestPath {
+		return "", false
+	}
+
+	return module, true
+}
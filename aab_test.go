@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func makeTestBundleManifest() []byte {
+	attr := func(name, value string) []byte {
+		return appendTestProtoBytes(appendTestProtoBytes(nil, 2, []byte(name)), 3, []byte(value))
+	}
+
+	var element []byte
+
+	element = appendTestProtoBytes(element, 3, []byte("manifest"))
+	element = appendTestProtoBytes(element, 4, attr("package", "com.example.app"))
+	element = appendTestProtoBytes(element, 4, attr("versionCode", "7"))
+
+	return appendTestProtoBytes(nil, 1, element)
+}
+
+func writeTestZip(t *testing.T, path string, names ...string) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+
+	for _, name := range names {
+		writer, err := zw.Create(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name == "base/manifest/AndroidManifest.xml" {
+			writer.Write(makeTestBundleManifest())
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInspectAppBundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.aab")
+
+	writeTestZip(t, path,
+		"BundleConfig.pb",
+		"base/manifest/AndroidManifest.xml",
+		"base/dex/classes.dex",
+		"feature/manifest/AndroidManifest.xml",
+		"feature/res/values.pb")
+
+	bi, err := inspectAppBundle(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(bi.bundleModules, []string{"base", "feature"}) {
+		t.Errorf("Expected [base feature], got %v", bi.bundleModules)
+	}
+
+	if bi.androidManifest.packageName != "com.example.app" || bi.androidManifest.versionCode != "7" {
+		t.Errorf("Expected com.example.app version 7, got %+v", bi.androidManifest)
+	}
+}
+
+func TestInspectAppBundleMissingBase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.aab")
+
+	writeTestZip(t, path, "BundleConfig.pb", "feature/manifest/AndroidManifest.xml")
+
+	if _, err := inspectAppBundle(path); err == nil {
+		t.Errorf("Expected error for bundle without base module")
+	}
+}
+
+func TestInspectAppBundleMissingConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.aab")
+
+	writeTestZip(t, path, "base/manifest/AndroidManifest.xml")
+
+	if _, err := inspectAppBundle(path); err == nil {
+		t.Errorf("Expected error for bundle without BundleConfig.pb")
+	}
+}
+
+func TestInspectAppBundleNotZip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.aab")
+
+	if err := os.WriteFile(path, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := inspectAppBundle(path); err == nil {
+		t.Errorf("Expected error for non-zip bundle")
+	}
+}
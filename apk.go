@@ -0,0 +1,245 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	apkSigBlockIDV2  = 0x7109871a
+	apkSigBlockIDV3  = 0xf05368c0
+	apkSigBlockIDV31 = 0x1b93ad61
+	apkSigBlockMagic = "APK Sig Block 42"
+	zipEOCDMaxSize   = zipEOCDMinSize + 0xffff // maximum comment length
+	zipEOCDMinSize   = 22
+	zipEOCDSignature = 0x06054b50
+)
+
+var apkEmulatorABIs = []string{"x86_64", "arm64-v8a"}
+
+//-----------------------------------------------------------------------------
+
+func inspectAPK(apkPath string) (*buildInfo, error) {
+	file, err := os.Open(apkPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read build at %q, error: %v", apkPath, err)
+	}
+
+	defer file.Close()
+
+	fi, err := file.Stat()
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read build at %q, error: %v", apkPath, err)
+	}
+
+	zr, err := zip.NewReader(file, fi.Size())
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid build at %q, error: %v", apkPath, err)
+	}
+
+	am, err := readAndroidManifest(zr)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %q in build at %q, error: %v", androidManifestName, apkPath, err)
+	}
+
+	schemes, err := verifyAPK(file, fi.Size(), zr)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid build at %q, error: %v", apkPath, err)
+	}
+
+	abis := findAPKNativeABIs(zr)
+
+	if err := checkEmulatorABIs(abis); err != nil {
+		return nil, fmt.Errorf("Invalid build at %q, error: %v", apkPath, err)
+	}
+
+	return &buildInfo{
+		androidManifest:  am,
+		nativeABIs:       abis,
+		signatureSchemes: schemes}, nil
+}
+
+// Checks the integrity of every entry and returns the signature schemes the
+// APK is signed with.
+func verifyAPK(r io.ReaderAt, size int64, zr *zip.Reader) ([]string, error) {
+	for _, file := range zr.File {
+		if err := verifyZipFile(file); err != nil {
+			return nil, fmt.Errorf("entry %q is corrupt: %v", file.Name, err)
+		}
+	}
+
+	schemes, err := findAPKSigningBlockSchemes(r, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if hasAPKJarSignature(zr) {
+		schemes = append([]string{"v1"}, schemes...)
+	}
+
+	if len(schemes) == 0 {
+		return nil, errors.New("APK is not signed, no APK Signing Block (v2/v3) or META-INF signature (v1) found")
+	}
+
+	return schemes, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func checkEmulatorABIs(abis []string) error {
+	if len(abis) == 0 || slices.ContainsFunc(abis, func(abi string) bool { return slices.Contains(apkEmulatorABIs, abi) }) {
+		return nil
+	}
+
+	return fmt.Errorf("native libraries are only provided for %s, an emulator needs %s", strings.Join(abis, ", "), strings.Join(apkEmulatorABIs, " or "))
+}
+
+func findAPKNativeABIs(zr *zip.Reader) []string {
+	var abis []string
+
+	for _, file := range zr.File {
+		folder, rest, _ := strings.Cut(file.Name, "/")
+
+		if folder != "lib" {
+			continue
+		}
+
+		if abi, _, found := strings.Cut(rest, "/"); found && len(abi) > 0 {
+			abis = appendIfMissing(abis, abi)
+		}
+	}
+
+	slices.Sort(abis)
+
+	return abis
+}
+
+func findAPKSigningBlockSchemes(r io.ReaderAt, size int64) ([]string, error) {
+	cdOffset, err := findZipCentralDirectoryOffset(r, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cdOffset < 32 {
+		return nil, nil
+	}
+
+	footer := make([]byte, 24)
+
+	if _, err := r.ReadAt(footer, cdOffset-24); err != nil {
+		return nil, err
+	}
+
+	if string(footer[8:]) != apkSigBlockMagic {
+		return nil, nil
+	}
+
+	blockSize := binary.LittleEndian.Uint64(footer)
+
+	if blockSize < 24 || blockSize > uint64(cdOffset-8) {
+		return nil, errors.New("APK Signing Block has an invalid size")
+	}
+
+	pairs := make([]byte, blockSize-24)
+
+	if _, err := r.ReadAt(pairs, cdOffset-int64(blockSize)); err != nil {
+		return nil, err
+	}
+
+	var schemes []string
+
+	for len(pairs) >= 12 {
+		pairSize := binary.LittleEndian.Uint64(pairs)
+
+		if pairSize < 4 || pairSize > uint64(len(pairs)-8) {
+			return nil, errors.New("APK Signing Block is malformed")
+		}
+
+		switch binary.LittleEndian.Uint32(pairs[8:]) {
+		case apkSigBlockIDV2:
+			schemes = append(schemes, "v2")
+
+		case apkSigBlockIDV3:
+			schemes = append(schemes, "v3")
+
+		case apkSigBlockIDV31:
+			schemes = append(schemes, "v3.1")
+		}
+
+		pairs = pairs[8+pairSize:]
+	}
+
+	return schemes, nil
+}
+
+func findZipCentralDirectoryOffset(r io.ReaderAt, size int64) (int64, error) {
+	tailSize := min(size, zipEOCDMaxSize)
+	tail := make([]byte, tailSize)
+
+	if _, err := r.ReadAt(tail, size-tailSize); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	for idx := len(tail) - zipEOCDMinSize; idx >= 0; idx-- {
+		if binary.LittleEndian.Uint32(tail[idx:]) == zipEOCDSignature {
+			return int64(binary.LittleEndian.Uint32(tail[idx+16:])), nil
+		}
+	}
+
+	return 0, errors.New("zip end of central directory not found")
+}
+
+func hasAPKJarSignature(zr *zip.Reader) bool {
+	hasManifest := false
+	hasSignatureFile := false
+	hasSignatureBlock := false
+
+	for _, file := range zr.File {
+		folder, name, _ := strings.Cut(file.Name, "/")
+
+		if folder != "META-INF" || strings.Contains(name, "/") {
+			continue
+		}
+
+		switch strings.ToUpper(path.Ext(name)) {
+		case ".DSA", ".EC", ".RSA":
+			hasSignatureBlock = true
+
+		case ".MF":
+			hasManifest = name == "MANIFEST.MF"
+
+		case ".SF":
+			hasSignatureFile = true
+		}
+	}
+
+	return hasManifest && hasSignatureFile && hasSignatureBlock
+}
+
+func verifyZipFile(file *zip.File) error {
+	reader, err := file.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	_, err = io.Copy(io.Discard, reader) // archive/zip checks the CRC-32 at EOF
+
+	return err
+}
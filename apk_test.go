@@ -0,0 +1,156 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func makeTestAPK(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	for _, name := range names {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Method: zip.Store,
+			Name:   name})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name == androidManifestName {
+			w.Write(makeTestAndroidManifest())
+		} else {
+			w.Write([]byte("contents of " + name))
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// Inserts an APK Signing Block with the given IDs before the central directory.
+func addTestAPKSigningBlock(t *testing.T, data []byte, ids ...uint32) []byte {
+	cdOffset, err := findZipCentralDirectoryOffset(bytes.NewReader(data), int64(len(data)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pairs []byte
+
+	for _, id := range ids {
+		pairs = binary.LittleEndian.AppendUint64(pairs, 8)
+		pairs = binary.LittleEndian.AppendUint32(pairs, id)
+		pairs = binary.LittleEndian.AppendUint32(pairs, 0)
+	}
+
+	blockSize := uint64(len(pairs) + 24)
+
+	var block []byte
+
+	block = binary.LittleEndian.AppendUint64(block, blockSize)
+	block = append(block, pairs...)
+	block = binary.LittleEndian.AppendUint64(block, blockSize)
+	block = append(block, apkSigBlockMagic...)
+
+	result := slices.Concat(data[:cdOffset], block, data[cdOffset:])
+	eocd := bytes.LastIndex(result, binary.LittleEndian.AppendUint32(nil, zipEOCDSignature))
+
+	binary.LittleEndian.PutUint32(result[eocd+16:], uint32(cdOffset)+uint32(len(block)))
+
+	return result
+}
+
+func verifyTestAPK(data []byte) ([]string, error) {
+	reader := bytes.NewReader(data)
+
+	zr, err := zip.NewReader(reader, reader.Size())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyAPK(reader, reader.Size(), zr)
+}
+
+//-----------------------------------------------------------------------------
+
+func TestCheckEmulatorABIs(t *testing.T) {
+	for _, abis := range [][]string{nil, {"arm64-v8a"}, {"armeabi-v7a", "x86_64"}} {
+		if err := checkEmulatorABIs(abis); err != nil {
+			t.Errorf("checkEmulatorABIs(%q) failed: %v", abis, err)
+		}
+	}
+
+	if err := checkEmulatorABIs([]string{"armeabi-v7a", "x86"}); err == nil {
+		t.Error("checkEmulatorABIs should fail without an emulator ABI")
+	}
+}
+
+func TestFindAPKNativeABIs(t *testing.T) {
+	data := makeTestAPK(t, "classes.dex", "lib/x86_64/libfoo.so", "lib/armeabi-v7a/libfoo.so", "lib/x86_64/libbar.so")
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if abis := findAPKNativeABIs(zr); !slices.Equal(abis, []string{"armeabi-v7a", "x86_64"}) {
+		t.Errorf("Unexpected ABIs: %q", abis)
+	}
+}
+
+func TestVerifyAPKChecksum(t *testing.T) {
+	data := makeTestAPK(t, "META-INF/MANIFEST.MF", "META-INF/CERT.SF", "META-INF/CERT.RSA", "classes.dex")
+
+	idx := bytes.Index(data, []byte("contents of classes.dex"))
+
+	data[idx] ^= 0xff
+
+	if _, err := verifyTestAPK(data); err == nil {
+		t.Error("verifyAPK should fail on a corrupt entry")
+	}
+}
+
+func TestVerifyAPKJarSignature(t *testing.T) {
+	data := makeTestAPK(t, "META-INF/MANIFEST.MF", "META-INF/CERT.SF", "META-INF/CERT.RSA", "classes.dex")
+
+	schemes, err := verifyTestAPK(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(schemes, []string{"v1"}) {
+		t.Errorf("Unexpected schemes: %q", schemes)
+	}
+}
+
+func TestVerifyAPKSigningBlock(t *testing.T) {
+	data := addTestAPKSigningBlock(t, makeTestAPK(t, "classes.dex"), apkSigBlockIDV2, 0x42726577, apkSigBlockIDV3)
+
+	schemes, err := verifyTestAPK(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(schemes, []string{"v2", "v3"}) {
+		t.Errorf("Unexpected schemes: %q", schemes)
+	}
+}
+
+func TestVerifyAPKUnsigned(t *testing.T) {
+	if _, err := verifyTestAPK(makeTestAPK(t, "META-INF/MANIFEST.MF", "classes.dex")); err == nil {
+		t.Error("verifyAPK should fail on an unsigned APK")
+	}
+}
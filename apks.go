@@ -0,0 +1,509 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	apkSetTOCName   = "toc.pb"
+	apkSetTargetABI = "x86_64"
+)
+
+type apkSetEntry struct {
+	abis       []string
+	master     bool
+	path       string
+	standalone bool
+	variant    int
+}
+
+type apkSetSelection struct {
+	paths  []string
+	reason string
+}
+
+//-----------------------------------------------------------------------------
+
+// Matches the `AbiAlias` enum of bundletool’s `targeting.proto`.
+var apkSetABIAliases = [...]string{
+	"",
+	"armeabi",
+	"armeabi-v7a",
+	"arm64-v8a",
+	"x86",
+	"x86_64",
+	"mips",
+	"mips64",
+	"riscv64"}
+
+//-----------------------------------------------------------------------------
+
+func inspectApkSet(apksPath string) (*buildInfo, error) {
+	zr, err := zip.OpenReader(apksPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read APK set at %q, error: %v", apksPath, err)
+	}
+
+	defer zr.Close()
+
+	var entries []apkSetEntry
+
+	if tocFile := findZipFile(&zr.Reader, apkSetTOCName); tocFile != nil {
+		data, err := readZipFile(tocFile)
+
+		if err == nil {
+			entries, err = parseApkSetTOC(data)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse %q in APK set at %q, error: %v", apkSetTOCName, apksPath, err)
+		}
+	} else {
+		entries = parseApkSetLayout(&zr.Reader)
+	}
+
+	selection, err := selectApkSetEntries(entries)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to select APKs from APK set at %q, error: %v", apksPath, err)
+	}
+
+	var (
+		abis    []string
+		am      *androidManifest
+		schemes []string
+	)
+
+	for _, apkPath := range selection.paths {
+		file := findZipFile(&zr.Reader, apkPath)
+
+		if file == nil {
+			return nil, fmt.Errorf("APK set at %q is missing %q", apksPath, apkPath)
+		}
+
+		reader, apkReader, err := readNestedAPK(file)
+
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read %q in APK set at %q, error: %v", apkPath, apksPath, err)
+		}
+
+		if apkPath == selection.baseAPKPath() {
+			if am, err = readAndroidManifest(apkReader); err != nil {
+				return nil, fmt.Errorf("Unable to read %q of %q in APK set at %q, error: %v", androidManifestName, apkPath, apksPath, err)
+			}
+		}
+
+		apkSchemes, err := verifyAPK(reader, reader.Size(), apkReader)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %q in APK set at %q, error: %v", apkPath, apksPath, err)
+		}
+
+		for _, abi := range findAPKNativeABIs(apkReader) {
+			abis = appendIfMissing(abis, abi)
+		}
+
+		for _, scheme := range apkSchemes {
+			schemes = appendIfMissing(schemes, scheme)
+		}
+	}
+
+	slices.Sort(abis)
+
+	if err := checkEmulatorABIs(abis); err != nil {
+		return nil, fmt.Errorf("Invalid APK selection in APK set at %q, error: %v", apksPath, err)
+	}
+
+	return &buildInfo{
+		androidManifest:  am,
+		apkSetSelection:  selection,
+		nativeABIs:       abis,
+		signatureSchemes: schemes}, nil
+}
+
+func writeApkSetSelection(payloadPath, apksPath string, selection *apkSetSelection) error {
+	zr, err := zip.OpenReader(apksPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer zr.Close()
+
+	payloadFile, err := os.Create(payloadPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer payloadFile.Close()
+
+	if len(selection.paths) == 1 {
+		file := findZipFile(&zr.Reader, selection.paths[0])
+
+		if file == nil {
+			return fmt.Errorf("Unable to find %q in APK set at %q", selection.paths[0], apksPath)
+		}
+
+		reader, err := file.Open()
+
+		if err != nil {
+			return err
+		}
+
+		defer reader.Close()
+
+		_, err = io.Copy(payloadFile, reader)
+
+		return err
+	}
+
+	zipWriter := zip.NewWriter(payloadFile)
+
+	for _, name := range append([]string{apkSetTOCName}, selection.paths...) {
+		file := findZipFile(&zr.Reader, name)
+
+		if file == nil {
+			if name == apkSetTOCName {
+				continue
+			}
+
+			zipWriter.Close()
+
+			return fmt.Errorf("Unable to find %q in APK set at %q", name, apksPath)
+		}
+
+		if err := zipWriter.Copy(file); err != nil {
+			zipWriter.Close()
+
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+//-----------------------------------------------------------------------------
+
+func (ass *apkSetSelection) baseAPKPath() string {
+	for _, apkPath := range ass.paths {
+		if path.Base(apkPath) == "base-master.apk" {
+			return apkPath
+		}
+	}
+
+	return ass.paths[0]
+}
+
+func (ass *apkSetSelection) isSingleAPK() bool {
+	return ass != nil && len(ass.paths) == 1
+}
+
+func (ass *apkSetSelection) string() string {
+	if ass == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s (%s)", strings.Join(ass.paths, ", "), ass.reason)
+}
+
+//-----------------------------------------------------------------------------
+
+func apkSetABIForSplitName(name string) string {
+	for _, abi := range apkSetABIAliases[1:] {
+		if strings.HasSuffix(name, "-"+strings.ReplaceAll(abi, "-", "_")+".apk") {
+			return abi
+		}
+	}
+
+	return ""
+}
+
+func decodeApkSetABITargeting(data []byte) ([]string, error) {
+	fields, err := decodeProtoFields(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var abis []string
+
+	for _, field := range fields {
+		if field.number != 1 { // value
+			continue
+		}
+
+		abiFields, err := decodeProtoFields(field.data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, abiField := range abiFields {
+			if abiField.number == 1 && abiField.value < uint64(len(apkSetABIAliases)) { // alias
+				abis = append(abis, apkSetABIAliases[abiField.value])
+			}
+		}
+	}
+
+	return abis, nil
+}
+
+func decodeApkSetDescription(data []byte, variant int) (apkSetEntry, error) {
+	entry := apkSetEntry{variant: variant}
+
+	fields, err := decodeProtoFields(data)
+
+	if err != nil {
+		return entry, err
+	}
+
+	for _, field := range fields {
+		switch field.number {
+		case 1: // targeting
+			targetingFields, err := decodeProtoFields(field.data)
+
+			if err != nil {
+				return entry, err
+			}
+
+			for _, targetingField := range targetingFields {
+				if targetingField.number == 1 { // abi_targeting
+					if entry.abis, err = decodeApkSetABITargeting(targetingField.data); err != nil {
+						return entry, err
+					}
+				}
+			}
+
+		case 2: // path
+			entry.path = string(field.data)
+
+		case 3: // split_apk_metadata
+			splitFields, err := decodeProtoFields(field.data)
+
+			if err != nil {
+				return entry, err
+			}
+
+			for _, splitField := range splitFields {
+				if splitField.number == 2 { // is_master_split
+					entry.master = splitField.value != 0
+				}
+			}
+
+		case 4: // standalone_apk_metadata
+			entry.standalone = true
+		}
+	}
+
+	return entry, nil
+}
+
+func nonEmpty(value string) []string {
+	if len(value) == 0 {
+		return nil
+	}
+
+	return []string{value}
+}
+
+func parseApkSetLayout(zr *zip.Reader) []apkSetEntry {
+	var entries []apkSetEntry
+
+	for _, file := range zr.File {
+		name := file.Name
+
+		if path.Ext(name) != ".apk" {
+			continue
+		}
+
+		switch path.Dir(name) {
+		case ".":
+			entries = append(entries, apkSetEntry{path: name, standalone: true})
+
+		case "splits":
+			entries = append(entries, apkSetEntry{
+				abis:   nonEmpty(apkSetABIForSplitName(name)),
+				master: strings.HasSuffix(name, "-master.apk"),
+				path:   name})
+
+		case "standalones":
+			var abis []string
+
+			for _, abi := range apkSetABIAliases[1:] {
+				if strings.HasPrefix(path.Base(name), "standalone-"+strings.ReplaceAll(abi, "-", "_")+"_") {
+					abis = []string{abi}
+				}
+			}
+
+			entries = append(entries, apkSetEntry{abis: abis, path: name, standalone: true})
+		}
+	}
+
+	return entries
+}
+
+func parseApkSetTOC(data []byte) ([]apkSetEntry, error) {
+	fields, err := decodeProtoFields(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []apkSetEntry
+
+	for idx, field := range fields {
+		if field.number != 1 { // variant
+			continue
+		}
+
+		variantFields, err := decodeProtoFields(field.data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		variant := idx
+
+		for _, variantField := range variantFields {
+			if variantField.number == 3 { // variant_number
+				variant = int(variantField.value)
+			}
+		}
+
+		for _, variantField := range variantFields {
+			if variantField.number != 2 { // apk_set
+				continue
+			}
+
+			apkSetFields, err := decodeProtoFields(variantField.data)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, apkSetField := range apkSetFields {
+				if apkSetField.number != 2 { // apk_description
+					continue
+				}
+
+				entry, err := decodeApkSetDescription(apkSetField.data, variant)
+
+				if err != nil {
+					return nil, err
+				}
+
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+func readNestedAPK(file *zip.File) (*bytes.Reader, *zip.Reader, error) {
+	data, err := readZipFile(file)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := bytes.NewReader(data)
+
+	zr, err := zip.NewReader(reader, reader.Size())
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reader, zr, nil
+}
+
+func selectApkSetEntries(entries []apkSetEntry) (*apkSetSelection, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("no APKs found")
+	}
+
+	for _, entry := range entries {
+		if path.Base(entry.path) == "universal.apk" {
+			return &apkSetSelection{
+				paths:  []string{entry.path},
+				reason: "universal APK"}, nil
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.standalone && slices.Contains(entry.abis, apkSetTargetABI) {
+			return &apkSetSelection{
+				paths:  []string{entry.path},
+				reason: "standalone APK for " + apkSetTargetABI + " emulator"}, nil
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.standalone && len(entry.abis) == 0 {
+			return &apkSetSelection{
+				paths:  []string{entry.path},
+				reason: "standalone APK without native code"}, nil
+		}
+	}
+
+	variant := -1
+
+	for _, entry := range entries {
+		if entry.master && entry.variant > variant {
+			variant = entry.variant
+		}
+	}
+
+	if variant < 0 {
+		return nil, fmt.Errorf("no universal APK, %s standalone APK or master split", apkSetTargetABI)
+	}
+
+	var (
+		paths     []string
+		hasABIs   bool
+		hasTarget bool
+	)
+
+	for _, entry := range entries {
+		if entry.standalone || entry.variant != variant {
+			continue
+		}
+
+		if len(entry.abis) > 0 {
+			hasABIs = true
+
+			if !slices.Contains(entry.abis, apkSetTargetABI) {
+				continue
+			}
+
+			hasTarget = true
+		}
+
+		paths = append(paths, entry.path)
+	}
+
+	if !hasABIs {
+		return &apkSetSelection{
+			paths:  paths,
+			reason: "splits without native code"}, nil
+	}
+
+	if !hasTarget {
+		return nil, fmt.Errorf("no split for %s emulator", apkSetTargetABI)
+	}
+
+	return &apkSetSelection{
+		paths:  paths,
+		reason: "splits for " + apkSetTargetABI + " emulator"}, nil
+}
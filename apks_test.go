@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func appendTestProtoBytes(buf []byte, number int, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(number<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+
+	return append(buf, data...)
+}
+
+func appendTestProtoVarint(buf []byte, number int, value uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(number<<3))
+
+	return binary.AppendUvarint(buf, value)
+}
+
+func makeTestApkDescription(path string, master bool, abi uint64) []byte {
+	var desc []byte
+
+	if abi > 0 {
+		alias := appendTestProtoVarint(nil, 1, abi)
+		abiTargeting := appendTestProtoBytes(nil, 1, alias)
+		desc = appendTestProtoBytes(desc, 1, appendTestProtoBytes(nil, 1, abiTargeting))
+	}
+
+	desc = appendTestProtoBytes(desc, 2, []byte(path))
+
+	var split []byte
+
+	if master {
+		split = appendTestProtoVarint(split, 2, 1)
+	}
+
+	return appendTestProtoBytes(desc, 3, split)
+}
+
+func TestParseApkSetTOC(t *testing.T) {
+	var apkSet []byte
+
+	apkSet = appendTestProtoBytes(apkSet, 2, makeTestApkDescription("splits/base-master.apk", true, 0))
+	apkSet = appendTestProtoBytes(apkSet, 2, makeTestApkDescription("splits/base-arm64_v8a.apk", false, 3))
+	apkSet = appendTestProtoBytes(apkSet, 2, makeTestApkDescription("splits/base-x86_64.apk", false, 5))
+
+	var variant []byte
+
+	variant = appendTestProtoBytes(variant, 2, apkSet)
+	variant = appendTestProtoVarint(variant, 3, 1)
+
+	toc := appendTestProtoBytes(nil, 1, variant)
+
+	entries, err := parseApkSetTOC(toc)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %v", entries)
+	}
+
+	if !entries[0].master || entries[0].variant != 1 {
+		t.Errorf("Expected master split in variant 1, got %v", entries[0])
+	}
+
+	if !slices.Equal(entries[2].abis, []string{"x86_64"}) {
+		t.Errorf("Expected [x86_64], got %v", entries[2].abis)
+	}
+
+	selection, err := selectApkSetEntries(entries)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(selection.paths, []string{"splits/base-master.apk", "splits/base-x86_64.apk"}) {
+		t.Errorf("Expected master and x86_64 splits, got %v", selection.paths)
+	}
+}
+
+func TestParseApkSetLayout(t *testing.T) {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	for _, name := range []string{"splits/base-master.apk", "splits/base-armeabi_v7a.apk", "splits/base-x86.apk", "splits/base-x86_64.apk", "splits/base-xxhdpi.apk"} {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selection, err := selectApkSetEntries(parseApkSetLayout(zr))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(selection.paths, []string{"splits/base-master.apk", "splits/base-x86_64.apk", "splits/base-xxhdpi.apk"}) {
+		t.Errorf("Expected master, x86_64 and density splits, got %v", selection.paths)
+	}
+}
+
+func TestSelectApkSetEntriesMissingABI(t *testing.T) {
+	entries := []apkSetEntry{
+		{master: true, path: "splits/base-master.apk"},
+		{abis: []string{"arm64-v8a"}, path: "splits/base-arm64_v8a.apk"}}
+
+	if _, err := selectApkSetEntries(entries); err == nil {
+		t.Errorf("Expected error for APK set without x86_64 split")
+	}
+}
+
+func TestSelectApkSetEntriesUniversal(t *testing.T) {
+	entries := []apkSetEntry{
+		{abis: []string{"x86_64"}, path: "standalones/standalone-x86_64_hdpi.apk", standalone: true},
+		{path: "universal.apk", standalone: true}}
+
+	selection, err := selectApkSetEntries(entries)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !selection.isSingleAPK() || selection.paths[0] != "universal.apk" {
+		t.Errorf("Expected universal.apk, got %v", selection.paths)
+	}
+}
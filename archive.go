@@ -0,0 +1,329 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	archiveMetadataFolder = "__MACOSX"
+	infoPlistName         = "Info.plist"
+)
+
+// Tar entries come in whatever order the archiver chose, so they are sorted
+// afterwards, as `zipFolder` does, to keep the payload reproducible.
+func convertTarToZip(zipPath, tarPath string) error {
+	unsortedPath := zipPath + ".unsorted"
+
+	defer os.Remove(unsortedPath)
+
+	if err := convertTarToUnsortedZip(unsortedPath, tarPath); err != nil {
+		return err
+	}
+
+	return sortZipFile(zipPath, unsortedPath)
+}
+
+func convertTarToUnsortedZip(zipPath, tarPath string) error {
+	tarFile, err := os.Open(tarPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer tarFile.Close()
+
+	gzipReader, err := gzip.NewReader(tarFile)
+
+	if err != nil {
+		return err
+	}
+
+	defer gzipReader.Close()
+
+	zipFile, err := os.Create(zipPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer zipFile.Close()
+
+	zipWriter := zip.NewWriter(zipFile)
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		hdr, err := tarReader.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			zipWriter.Close()
+
+			return err
+		}
+
+		name, ok := normalizeArchiveEntryName(hdr.Name)
+
+		if !ok || isArchiveMetadata(name) {
+			continue
+		}
+
+		if err := writeTarEntry(zipWriter, tarReader, hdr, name); err != nil {
+			zipWriter.Close()
+
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+func describeArchivedAppError(archivePath string, err error) error {
+	return fmt.Errorf("Archive at %q must contain exactly one top-level .app with an %q, found %v", archivePath, infoPlistName, err)
+}
+
+func findArchivedApp(names []string) (string, error) {
+	var appNames []string
+
+	hasInfoPlist := map[string]bool{}
+
+	for _, name := range names {
+		if isArchiveMetadata(name) {
+			continue
+		}
+
+		topName, rest, _ := strings.Cut(name, "/")
+
+		if !strings.HasSuffix(topName, ".app") {
+			return "", fmt.Errorf("unexpected top-level entry %q", topName)
+		}
+
+		if !slices.Contains(appNames, topName) {
+			appNames = append(appNames, topName)
+		}
+
+		if rest == infoPlistName {
+			hasInfoPlist[topName] = true
+		}
+	}
+
+	switch len(appNames) {
+	case 0:
+		return "", errors.New("no top-level .app")
+
+	case 1:
+		if !hasInfoPlist[appNames[0]] {
+			return "", fmt.Errorf("no %q in %q", infoPlistName, appNames[0])
+		}
+
+		return appNames[0], nil
+
+	default:
+		return "", fmt.Errorf("more than one top-level .app (%s)", strings.Join(appNames, ", "))
+	}
+}
+
+func inspectAppArchive(archivePath, archiveSuffix string) (*buildInfo, error) {
+	if archiveSuffix == "zip" {
+		return inspectZippedApp(archivePath)
+	}
+
+	return inspectTarredApp(archivePath)
+}
+
+func inspectTarredApp(tarPath string) (*buildInfo, error) {
+	names, files, err := listTarEntries(tarPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read archive at %q, error: %v", tarPath, err)
+	}
+
+	appName, err := findArchivedApp(names)
+
+	if err != nil {
+		return nil, describeArchivedAppError(tarPath, err)
+	}
+
+	abc := &appBundleContents{
+		readFile: func(name string) ([]byte, error) {
+			if data, ok := files[path.Join(appName, name)]; ok {
+				return data, nil
+			}
+
+			return nil, fs.ErrNotExist
+		}}
+
+	for _, name := range names {
+		if rest, found := strings.CutPrefix(name, appName+"/"); found {
+			abc.names = append(abc.names, rest)
+		}
+	}
+
+	abi, err := abc.inspect(tarPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &buildInfo{
+		appName:         appName,
+		appleBundleInfo: abi}, nil
+}
+
+func inspectZippedApp(zipPath string) (*buildInfo, error) {
+	zr, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read archive at %q, error: %v", zipPath, err)
+	}
+
+	defer zr.Close()
+
+	var names []string
+
+	for _, file := range zr.File {
+		if name, ok := normalizeArchiveEntryName(file.Name); ok {
+			names = append(names, name)
+		}
+	}
+
+	appName, err := findArchivedApp(names)
+
+	if err != nil {
+		return nil, describeArchivedAppError(zipPath, err)
+	}
+
+	abi, err := newZipAppBundleContents(&zr.Reader, appName).inspect(zipPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &buildInfo{
+		appName:         appName,
+		appleBundleInfo: abi}, nil
+}
+
+func isArchiveMetadata(name string) bool {
+	return name == archiveMetadataFolder || strings.HasPrefix(name, archiveMetadataFolder+"/")
+}
+
+func isArchivedAppInspectable(name string, executable bool) bool {
+	appName, rest, _ := strings.Cut(name, "/")
+
+	return strings.HasSuffix(appName, ".app") && isAppBundleInspectable(rest, executable)
+}
+
+func listTarEntries(tarPath string) ([]string, map[string][]byte, error) {
+	tarFile, err := os.Open(tarPath)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tarFile.Close()
+
+	gzipReader, err := gzip.NewReader(tarFile)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	var names []string
+
+	files := map[string][]byte{}
+
+	for {
+		hdr, err := tarReader.Next()
+
+		if err == io.EOF {
+			return names, files, nil
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name, ok := normalizeArchiveEntryName(hdr.Name)
+
+		if !ok {
+			continue
+		}
+
+		names = append(names, name)
+
+		if hdr.Typeflag == tar.TypeReg && isArchivedAppInspectable(name, hdr.Mode&0111 != 0) {
+			if files[name], err = io.ReadAll(tarReader); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
+
+// Keeps directories, symlinks and mode bits the way `zipFolder` does; other
+// entry types, such as hard links, are dropped.
+func writeTarEntry(zipWriter *zip.Writer, tarReader *tar.Reader, hdr *tar.Header, name string) error {
+	fh, err := zip.FileInfoHeader(hdr.FileInfo())
+
+	if err != nil {
+		return err
+	}
+
+	fh.Name = name
+
+	var contents io.Reader
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		fh.Name += "/"
+
+	case tar.TypeReg:
+		if !isCompressedFile(name) {
+			fh.Method = zip.Deflate
+		}
+
+		contents = tarReader
+
+	case tar.TypeSymlink:
+		contents = strings.NewReader(hdr.Linkname)
+
+	default:
+		return nil
+	}
+
+	normalizeZipHeader(fh)
+
+	writer, err := zipWriter.CreateHeader(fh)
+
+	if err == nil && contents != nil {
+		_, err = io.Copy(writer, contents)
+	}
+
+	return err
+}
+
+func normalizeArchiveEntryName(name string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+
+	return name, true
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"debug/macho"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeTestTarball(t *testing.T, path string, files map[string]string) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	if err := tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		hdr := &tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertTarToZip(t *testing.T) {
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "MyApp.tar.gz")
+	zipPath := filepath.Join(dir, "MyApp.zip")
+
+	writeTestTarball(t, tarPath, map[string]string{
+		"MyApp.app/Info.plist": "plist",
+		"MyApp.app/MyApp":      "binary"})
+
+	if err := convertTarToZip(zipPath, tarPath); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer zr.Close()
+
+	var names []string
+
+	for _, file := range zr.File {
+		names = append(names, file.Name)
+	}
+
+	slices.Sort(names)
+
+	if !slices.Equal(names, []string{"MyApp.app/Info.plist", "MyApp.app/MyApp"}) {
+		t.Errorf("Expected [MyApp.app/Info.plist MyApp.app/MyApp], got %v", names)
+	}
+}
+
+func TestConvertTarToZipIsSorted(t *testing.T) {
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "MyApp.tgz")
+	zipPath := filepath.Join(dir, "MyApp.zip")
+
+	file, err := os.Create(tarPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	names := []string{"MyApp.app/MyApp", "MyApp.app/Info.plist", "MyApp.app/Base.lproj/Main.nib"}
+
+	for _, name := range names {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+		tw.Write([]byte("data"))
+	}
+
+	tw.Close()
+	gw.Close()
+	file.Close()
+
+	if err := convertTarToZip(zipPath, tarPath); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer zr.Close()
+
+	var zipNames []string
+
+	for _, file := range zr.File {
+		zipNames = append(zipNames, file.Name)
+	}
+
+	slices.Sort(names)
+
+	if !slices.Equal(zipNames, names) {
+		t.Errorf("Expected entries %q, got %q", names, zipNames)
+	}
+
+	if _, err := os.Stat(zipPath + ".unsorted"); !os.IsNotExist(err) {
+		t.Error("Expected unsorted zip to be removed")
+	}
+}
+
+func TestConvertTarToZipPreservesLinksAndModes(t *testing.T) {
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "MyApp.tgz")
+	zipPath := filepath.Join(dir, "MyApp.zip")
+
+	file, err := os.Create(tarPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	tw.WriteHeader(&tar.Header{Name: "MyApp.app/MyApp", Typeflag: tar.TypeReg, Mode: 0755, Size: 6})
+	tw.Write([]byte("binary"))
+	tw.WriteHeader(&tar.Header{Name: "MyApp.app/Current", Typeflag: tar.TypeSymlink, Linkname: "MyApp", Mode: 0777})
+	tw.Close()
+	gw.Close()
+	file.Close()
+
+	if err := convertTarToZip(zipPath, tarPath); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer zr.Close()
+
+	binary := findZipFile(&zr.Reader, "MyApp.app/MyApp")
+
+	if binary == nil || binary.Mode().Perm() != 0755 {
+		t.Error("Expected executable to keep its mode bits")
+	}
+
+	link := findZipFile(&zr.Reader, "MyApp.app/Current")
+
+	if link == nil || link.Mode()&fs.ModeSymlink == 0 {
+		t.Fatal("Expected symlink to be stored as a symlink")
+	}
+
+	if target, _ := readZipFile(link); string(target) != "MyApp" {
+		t.Errorf("Expected symlink to target %q, got %q", "MyApp", target)
+	}
+}
+
+func TestFindArchivedApp(t *testing.T) {
+	appName, err := findArchivedApp([]string{"MyApp.app", "MyApp.app/Info.plist", "MyApp.app/MyApp", "__MACOSX/MyApp.app/._Info.plist"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if appName != "MyApp.app" {
+		t.Errorf("Expected \"MyApp.app\", got %q", appName)
+	}
+}
+
+func TestFindArchivedAppMissingInfoPlist(t *testing.T) {
+	if _, err := findArchivedApp([]string{"MyApp.app/MyApp"}); err == nil {
+		t.Errorf("Expected error for app without Info.plist")
+	}
+}
+
+func TestFindArchivedAppMultiple(t *testing.T) {
+	if _, err := findArchivedApp([]string{"A.app/Info.plist", "B.app/Info.plist"}); err == nil {
+		t.Errorf("Expected error for archive with multiple apps")
+	}
+}
+
+func TestFindArchivedAppUnexpectedEntry(t *testing.T) {
+	if _, err := findArchivedApp([]string{"MyApp.app/Info.plist", "README.txt"}); err == nil {
+		t.Errorf("Expected error for archive with stray top-level entry")
+	}
+}
+
+func TestInspectAppArchiveTarball(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MyApp.tgz")
+
+	writeTestTarball(t, path, map[string]string{
+		"MyApp.app/Info.plist": testAppInfoPlist,
+		"MyApp.app/MyApp":      string(makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOSSimulator))})
+
+	bi, err := inspectAppArchive(path, "tgz")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bi.appName != "MyApp.app" {
+		t.Errorf("Expected \"MyApp.app\", got %q", bi.appName)
+	}
+
+	if bi.appleBundleInfo.identifier != "com.example.MyApp" {
+		t.Errorf("Expected \"com.example.MyApp\", got %q", bi.appleBundleInfo.identifier)
+	}
+}
+
+func TestInspectAppArchiveTarballDottedExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MyApp.tgz")
+
+	file, err := os.Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+
+	infoPlist := makeTestBinaryPlist([]string{"CFBundleExecutable", "CFBundleIdentifier"}, []any{"My.App", "com.example.MyApp"})
+	executable := makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOSSimulator)
+
+	tw.WriteHeader(&tar.Header{Name: "MyApp.app/Info.plist", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(infoPlist))})
+	tw.Write(infoPlist)
+	tw.WriteHeader(&tar.Header{Name: "MyApp.app/My.App", Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(executable))})
+	tw.Write(executable)
+	tw.Close()
+	gw.Close()
+	file.Close()
+
+	bi, err := inspectAppArchive(path, "tgz")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bi.appleBundleInfo.executable != "My.App" {
+		t.Errorf("Expected \"My.App\", got %q", bi.appleBundleInfo.executable)
+	}
+}
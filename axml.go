@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf16"
+)
+
+const (
+	axmlChunkEndElement     = 0x0103
+	axmlChunkResourceMap    = 0x0180
+	axmlChunkStartElement   = 0x0102
+	axmlChunkStringPool     = 0x0001
+	axmlChunkXML            = 0x0003
+	axmlNoIndex             = 0xffffffff
+	axmlStringPoolUTF8Flag  = 1 << 8
+	axmlValueTypeAttribute  = 0x02
+	axmlValueTypeBoolean    = 0x12
+	axmlValueTypeColorFirst = 0x1c
+	axmlValueTypeColorLast  = 0x1f
+	axmlValueTypeDimension  = 0x05
+	axmlValueTypeFloat      = 0x04
+	axmlValueTypeFraction   = 0x06
+	axmlValueTypeIntDec     = 0x10
+	axmlValueTypeIntHex     = 0x11
+	axmlValueTypeNull       = 0x00
+	axmlValueTypeReference  = 0x01
+	axmlValueTypeString     = 0x03
+)
+
+type axmlAttribute struct {
+	name       string
+	resourceID uint32
+	value      string
+}
+
+type axmlNode struct {
+	attributes []axmlAttribute
+	children   []*axmlNode
+	name       string
+}
+
+//-----------------------------------------------------------------------------
+
+func parseAXML(data []byte) (*axmlNode, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != axmlChunkXML {
+		return nil, errors.New("not a binary XML document")
+	}
+
+	var (
+		resourceIDs []uint32
+		root        *axmlNode
+		stack       []*axmlNode
+		pool        []string
+	)
+
+	offset := int(binary.LittleEndian.Uint16(data[2:]))
+
+	for offset+8 <= len(data) {
+		chunkType := binary.LittleEndian.Uint16(data[offset:])
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4:]))
+
+		if chunkSize < 8 || offset+chunkSize > len(data) {
+			return nil, fmt.Errorf("malformed chunk at offset %d", offset)
+		}
+
+		chunk := data[offset : offset+chunkSize]
+
+		switch chunkType {
+		case axmlChunkStringPool:
+			var err error
+
+			if pool, err = parseAXMLStringPool(chunk); err != nil {
+				return nil, err
+			}
+
+		case axmlChunkResourceMap:
+			for idx := 8; idx+4 <= len(chunk); idx += 4 {
+				resourceIDs = append(resourceIDs, binary.LittleEndian.Uint32(chunk[idx:]))
+			}
+
+		case axmlChunkStartElement:
+			node, err := parseAXMLStartElement(chunk, pool, resourceIDs)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+
+			stack = append(stack, node)
+
+		case axmlChunkEndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+
+		offset += chunkSize
+	}
+
+	if root == nil {
+		return nil, errors.New("no root element")
+	}
+
+	return root, nil
+}
+
+// Decodes the protobuf `XmlNode` format that aapt2 uses for the manifests of
+// app bundles.
+func parseProtoXML(data []byte) (*axmlNode, error) {
+	fields, err := decodeProtoFields(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		if field.number == 1 { // element
+			return parseProtoXMLElement(field.data)
+		}
+	}
+
+	return nil, nil // text node
+}
+
+//-----------------------------------------------------------------------------
+
+func (an *axmlNode) attribute(name string, resourceID uint32) (string, bool) {
+	for _, attr := range an.attributes {
+		if (resourceID != 0 && attr.resourceID == resourceID) || attr.name == name {
+			return attr.value, true
+		}
+	}
+
+	return "", false
+}
+
+//-----------------------------------------------------------------------------
+
+func axmlString(pool []string, idx uint32) string {
+	if idx == axmlNoIndex || int(idx) >= len(pool) {
+		return ""
+	}
+
+	return pool[idx]
+}
+
+func decodeAXMLUTF16String(data []byte) (string, error) {
+	if len(data) < 2 {
+		return "", errors.New("truncated string")
+	}
+
+	length := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+
+	if length&0x8000 != 0 {
+		if len(data) < 2 {
+			return "", errors.New("truncated string")
+		}
+
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(data))
+		data = data[2:]
+	}
+
+	if len(data) < length*2 {
+		return "", errors.New("truncated string")
+	}
+
+	units := make([]uint16, length)
+
+	for idx := range units {
+		units[idx] = binary.LittleEndian.Uint16(data[idx*2:])
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+func decodeAXMLUTF8Length(data []byte) (int, []byte, error) {
+	if len(data) < 1 {
+		return 0, nil, errors.New("truncated string")
+	}
+
+	if data[0]&0x80 == 0 {
+		return int(data[0]), data[1:], nil
+	}
+
+	if len(data) < 2 {
+		return 0, nil, errors.New("truncated string")
+	}
+
+	return int(data[0]&0x7f)<<8 | int(data[1]), data[2:], nil
+}
+
+func decodeAXMLUTF8String(data []byte) (string, error) {
+	_, data, err := decodeAXMLUTF8Length(data) // UTF-16 length
+
+	if err != nil {
+		return "", err
+	}
+
+	length, data, err := decodeAXMLUTF8Length(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < length {
+		return "", errors.New("truncated string")
+	}
+
+	return string(data[:length]), nil
+}
+
+func formatAXMLValue(dataType uint8, data uint32, pool []string) string {
+	switch dataType {
+	case axmlValueTypeBoolean:
+		return strconv.FormatBool(data != 0)
+
+	case axmlValueTypeFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(data)), 'g', -1, 32)
+
+	case axmlValueTypeIntDec:
+		return strconv.FormatInt(int64(int32(data)), 10)
+
+	case axmlValueTypeIntHex:
+		return fmt.Sprintf("0x%x", data)
+
+	case axmlValueTypeAttribute:
+		return fmt.Sprintf("?0x%08x", data)
+
+	case axmlValueTypeReference:
+		return fmt.Sprintf("@0x%08x", data)
+
+	case axmlValueTypeString:
+		return axmlString(pool, data)
+
+	case axmlValueTypeNull:
+		return ""
+
+	default:
+		if dataType >= axmlValueTypeColorFirst && dataType <= axmlValueTypeColorLast {
+			return fmt.Sprintf("#%08x", data)
+		}
+
+		return fmt.Sprintf("0x%08x", data)
+	}
+}
+
+func parseAXMLStartElement(chunk []byte, pool []string, resourceIDs []uint32) (*axmlNode, error) {
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+
+	if headerSize+20 > len(chunk) {
+		return nil, errors.New("truncated start element")
+	}
+
+	ext := chunk[headerSize:]
+
+	node := &axmlNode{name: axmlString(pool, binary.LittleEndian.Uint32(ext[4:]))}
+
+	attrStart := int(binary.LittleEndian.Uint16(ext[8:]))
+	attrSize := int(binary.LittleEndian.Uint16(ext[10:]))
+	attrCount := int(binary.LittleEndian.Uint16(ext[12:]))
+
+	if attrSize < 20 || attrStart+attrSize*attrCount > len(ext) {
+		return nil, errors.New("truncated element attributes")
+	}
+
+	for idx := 0; idx < attrCount; idx++ {
+		attr := ext[attrStart+idx*attrSize:]
+		nameIdx := binary.LittleEndian.Uint32(attr[4:])
+		rawValue := binary.LittleEndian.Uint32(attr[8:])
+		dataType := attr[15]
+		data := binary.LittleEndian.Uint32(attr[16:])
+
+		value := formatAXMLValue(dataType, data, pool)
+
+		if dataType == axmlValueTypeString && rawValue != axmlNoIndex {
+			value = axmlString(pool, rawValue)
+		}
+
+		resourceID := uint32(0)
+
+		if int(nameIdx) < len(resourceIDs) {
+			resourceID = resourceIDs[nameIdx]
+		}
+
+		node.attributes = append(node.attributes, axmlAttribute{
+			name:       axmlString(pool, nameIdx),
+			resourceID: resourceID,
+			value:      value})
+	}
+
+	return node, nil
+}
+
+func parseAXMLStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errors.New("truncated string pool")
+	}
+
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	count := int(binary.LittleEndian.Uint32(chunk[8:]))
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+
+	if headerSize+count*4 > len(chunk) || stringsStart > len(chunk) {
+		return nil, errors.New("truncated string pool")
+	}
+
+	pool := make([]string, count)
+
+	for idx := range pool {
+		offset := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+idx*4:]))
+
+		if offset >= len(chunk) {
+			return nil, errors.New("string pool offset out of range")
+		}
+
+		var err error
+
+		if flags&axmlStringPoolUTF8Flag != 0 {
+			pool[idx], err = decodeAXMLUTF8String(chunk[offset:])
+		} else {
+			pool[idx], err = decodeAXMLUTF16String(chunk[offset:])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pool, nil
+}
+
+func parseProtoXMLAttribute(data []byte) (axmlAttribute, error) {
+	attr := axmlAttribute{}
+
+	fields, err := decodeProtoFields(data)
+
+	if err != nil {
+		return attr, err
+	}
+
+	for _, field := range fields {
+		switch field.number {
+		case 2: // name
+			attr.name = string(field.data)
+
+		case 3: // value
+			attr.value = string(field.data)
+
+		case 5: // resource_id
+			attr.resourceID = uint32(field.value)
+		}
+	}
+
+	return attr, nil
+}
+
+func parseProtoXMLElement(data []byte) (*axmlNode, error) {
+	node := &axmlNode{}
+
+	fields, err := decodeProtoFields(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		switch field.number {
+		case 3: // name
+			node.name = string(field.data)
+
+		case 4: // attribute
+			attr, err := parseProtoXMLAttribute(field.data)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.attributes = append(node.attributes, attr)
+
+		case 5: // child
+			child, err := parseProtoXML(field.data)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if child != nil {
+				node.children = append(node.children, child)
+			}
+		}
+	}
+
+	return node, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+type testAXMLAttribute struct {
+	data     uint32
+	dataType uint8
+	name     string
+}
+
+type testAXMLEncoder struct {
+	body    bytes.Buffer
+	indices map[string]uint32
+	pool    []string
+}
+
+func newTestAXMLEncoder(attrNames ...string) *testAXMLEncoder {
+	enc := &testAXMLEncoder{indices: map[string]uint32{}}
+
+	for _, name := range attrNames {
+		enc.stringIndex(name)
+	}
+
+	return enc
+}
+
+func (enc *testAXMLEncoder) bytes(resourceIDs []uint32) []byte {
+	var pool bytes.Buffer
+
+	offsets := make([]uint32, len(enc.pool))
+
+	var data bytes.Buffer
+
+	for idx, value := range enc.pool {
+		offsets[idx] = uint32(data.Len())
+
+		units := utf16.Encode([]rune(value))
+
+		binary.Write(&data, binary.LittleEndian, uint16(len(units)))
+		binary.Write(&data, binary.LittleEndian, units)
+		binary.Write(&data, binary.LittleEndian, uint16(0))
+	}
+
+	for data.Len()%4 != 0 {
+		data.WriteByte(0)
+	}
+
+	poolHeaderSize := 28
+	stringsStart := poolHeaderSize + 4*len(offsets)
+
+	binary.Write(&pool, binary.LittleEndian, []uint16{axmlChunkStringPool, uint16(poolHeaderSize)})
+	binary.Write(&pool, binary.LittleEndian, []uint32{uint32(stringsStart + data.Len()), uint32(len(offsets)), 0, 0, uint32(stringsStart), 0})
+	binary.Write(&pool, binary.LittleEndian, offsets)
+
+	pool.Write(data.Bytes())
+
+	var resMap bytes.Buffer
+
+	binary.Write(&resMap, binary.LittleEndian, []uint16{axmlChunkResourceMap, 8})
+	binary.Write(&resMap, binary.LittleEndian, uint32(8+4*len(resourceIDs)))
+	binary.Write(&resMap, binary.LittleEndian, resourceIDs)
+
+	var doc bytes.Buffer
+
+	binary.Write(&doc, binary.LittleEndian, []uint16{axmlChunkXML, 8})
+	binary.Write(&doc, binary.LittleEndian, uint32(8+pool.Len()+resMap.Len()+enc.body.Len()))
+
+	doc.Write(pool.Bytes())
+	doc.Write(resMap.Bytes())
+	doc.Write(enc.body.Bytes())
+
+	return doc.Bytes()
+}
+
+func (enc *testAXMLEncoder) end(name string) {
+	binary.Write(&enc.body, binary.LittleEndian, []uint16{axmlChunkEndElement, 16})
+	binary.Write(&enc.body, binary.LittleEndian, []uint32{24, 0, axmlNoIndex, axmlNoIndex, enc.stringIndex(name)})
+}
+
+func (enc *testAXMLEncoder) start(name string, attrs ...testAXMLAttribute) {
+	binary.Write(&enc.body, binary.LittleEndian, []uint16{axmlChunkStartElement, 16})
+	binary.Write(&enc.body, binary.LittleEndian, []uint32{uint32(36 + 20*len(attrs)), 0, axmlNoIndex, axmlNoIndex, enc.stringIndex(name)})
+	binary.Write(&enc.body, binary.LittleEndian, []uint16{20, 20, uint16(len(attrs)), 0, 0, 0})
+
+	for _, attr := range attrs {
+		rawValue := uint32(axmlNoIndex)
+
+		if attr.dataType == axmlValueTypeString {
+			rawValue = attr.data
+		}
+
+		binary.Write(&enc.body, binary.LittleEndian, []uint32{axmlNoIndex, enc.stringIndex(attr.name), rawValue})
+		binary.Write(&enc.body, binary.LittleEndian, []uint8{8, 0, 0, attr.dataType})
+		binary.Write(&enc.body, binary.LittleEndian, attr.data)
+	}
+}
+
+func (enc *testAXMLEncoder) str(name, value string) testAXMLAttribute {
+	return testAXMLAttribute{data: enc.stringIndex(value), dataType: axmlValueTypeString, name: name}
+}
+
+func (enc *testAXMLEncoder) stringIndex(value string) uint32 {
+	if idx, ok := enc.indices[value]; ok {
+		return idx
+	}
+
+	enc.indices[value] = uint32(len(enc.pool))
+	enc.pool = append(enc.pool, value)
+
+	return enc.indices[value]
+}
+
+func makeTestAndroidManifest() []byte {
+	// Attribute names backed by the resource map must come first in the pool
+	enc := newTestAXMLEncoder("versionCode", "versionName", "minSdkVersion", "targetSdkVersion", "debuggable", "name")
+
+	enc.start("manifest", enc.str("package", "com.example.app"), testAXMLAttribute{data: 42, dataType: axmlValueTypeIntDec, name: "versionCode"}, enc.str("versionName", "1.2.3"))
+	enc.start("uses-sdk", testAXMLAttribute{data: 24, dataType: axmlValueTypeIntDec, name: "minSdkVersion"}, testAXMLAttribute{data: 34, dataType: axmlValueTypeIntDec, name: "targetSdkVersion"})
+	enc.end("uses-sdk")
+	enc.start("application", testAXMLAttribute{data: 0xffffffff, dataType: axmlValueTypeBoolean, name: "debuggable"})
+	enc.start("activity", enc.str("name", ".SettingsActivity"))
+	enc.end("activity")
+	enc.start("activity", enc.str("name", ".MainActivity"))
+	enc.start("intent-filter")
+	enc.start("action", enc.str("name", "android.intent.action.MAIN"))
+	enc.end("action")
+	enc.start("category", enc.str("name", "android.intent.category.LAUNCHER"))
+	enc.end("category")
+	enc.end("intent-filter")
+	enc.end("activity")
+	enc.end("application")
+	enc.end("manifest")
+
+	return enc.bytes([]uint32{
+		androidAttrVersionCode,
+		androidAttrVersionName,
+		androidAttrMinSdkVersion,
+		androidAttrTargetSdkVersion,
+		androidAttrDebuggable,
+		androidAttrName})
+}
+
+func TestExtractAndroidManifest(t *testing.T) {
+	root, err := parseAXML(makeTestAndroidManifest())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	am, err := extractAndroidManifest(root)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := androidManifest{
+		debuggable:       true,
+		launcherActivity: "com.example.app.MainActivity",
+		minSdkVersion:    "24",
+		packageName:      "com.example.app",
+		targetSdkVersion: "34",
+		versionCode:      "42",
+		versionName:      "1.2.3"}
+
+	if *am != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *am)
+	}
+}
+
+func TestParseAXMLNotBinaryXML(t *testing.T) {
+	if _, err := parseAXML([]byte("<manifest/>")); err == nil {
+		t.Errorf("Expected error for text XML")
+	}
+}
+
+func TestResolveAndroidClassName(t *testing.T) {
+	for name, expected := range map[string]string{
+		".Main":             "com.example.Main",
+		"Main":              "com.example.Main",
+		"com.other.Main":    "com.other.Main",
+		"com.example.a.Foo": "com.example.a.Foo"} {
+		if actual := resolveAndroidClassName("com.example", name); actual != expected {
+			t.Errorf("Expected %q, got %q", expected, actual)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+type buildInfo struct {
+	androidManifest     *androidManifest
+	apkSetSelection     *apkSetSelection
+	appName             string
+	appPath             string
+	appleBundleInfo     *appleBundleInfo
+	archiveCreationDate time.Time
+	archiveScheme       string
+	bundleModules       []string
+	nativeABIs          []string
+	signatureSchemes    []string
+}
+
+//-----------------------------------------------------------------------------
+
+func inspectBuildInfo(buildPath, buildSuffix string) (*buildInfo, error) {
+	switch buildSuffix {
+	case "aab":
+		return inspectAppBundle(buildPath)
+
+	case "apk":
+		return inspectAPK(buildPath)
+
+	case "apks":
+		return inspectApkSet(buildPath)
+
+	case "app":
+		return inspectApp(buildPath)
+
+	case "ipa":
+		return inspectIPA(buildPath)
+
+	case "tar.gz", "tgz", "zip":
+		return inspectAppArchive(buildPath, buildSuffix)
+
+	case "xcarchive":
+		return inspectXcodeArchive(buildPath)
+
+	default:
+		return &buildInfo{}, nil
+	}
+}
+
+func writeBuildPayload(payloadPath, buildPath, buildSuffix string, bi *buildInfo, compressionLevel int) error {
+	switch buildSuffix {
+	case "aab", "apk", "zip":
+		if !isRegular(buildPath) {
+			return fmt.Errorf("Unable to read build at %q", buildPath)
+		}
+
+		return nil
+
+	case "apks":
+		if !isRegular(buildPath) {
+			return fmt.Errorf("Unable to read build at %q", buildPath)
+		}
+
+		return writeApkSetSelection(payloadPath, buildPath, bi.apkSetSelection)
+
+	case "app", "xcarchive":
+		appPath := bi.appPath
+
+		if !isDir(appPath) {
+			return fmt.Errorf("Unable to read build at %q", appPath)
+		}
+
+		return zipFolder(payloadPath, filepath.Dir(appPath), filepath.Base(appPath), compressionLevel)
+
+	case "ipa":
+		if !isRegular(buildPath) {
+			return fmt.Errorf("Unable to read build at %q", buildPath)
+		}
+
+		return repackageIPA(payloadPath, buildPath, bi.appName)
+
+	case "tar.gz", "tgz":
+		if !isRegular(buildPath) {
+			return fmt.Errorf("Unable to read build at %q", buildPath)
+		}
+
+		return convertTarToZip(payloadPath, buildPath)
+
+	default:
+		return fmt.Errorf("Unable to read build at %q", buildPath)
+	}
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const defaultUploadPartSize = 8 * 1024 * 1024
+
+//-----------------------------------------------------------------------------
+
+type UploadPart struct {
+	Number int    `json:"number"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type UploadSession struct {
+	BuildURL    string       `json:"buildURL"`
+	ContentType string       `json:"contentType"`
+	PartSize    int64        `json:"partSize"`
+	Parts       []UploadPart `json:"parts"`
+	SHA256      string       `json:"sha256"`
+	Size        int64        `json:"size"`
+	UploadID    string       `json:"uploadID"`
+}
+
+type UploadSessionStatus struct {
+	Parts []UploadPart `json:"parts"`
+}
+
+type partUploader func(file *os.File, us *UploadSession, parts []UploadPart, retryAllowed bool) (bool, error)
+
+//-----------------------------------------------------------------------------
+
+// Hashes the payload in a single pass, in fixed-size parts and, unless its
+// digest is already known, as a whole, so that a session can be matched
+// against a previous invocation.
+func newUploadSession(payloadPath, payloadSHA256, buildURL, contentType string, partSize int64) (*UploadSession, error) {
+	file, err := os.Open(payloadPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	us := &UploadSession{
+		BuildURL:    buildURL,
+		ContentType: contentType,
+		PartSize:    partSize,
+		SHA256:      payloadSHA256}
+
+	var payloadHash hash.Hash
+
+	if len(payloadSHA256) == 0 {
+		payloadHash = sha256.New()
+	}
+
+	for number := 1; ; number++ {
+		partHash := sha256.New()
+
+		writer := io.Writer(partHash)
+
+		if payloadHash != nil {
+			writer = io.MultiWriter(payloadHash, partHash)
+		}
+
+		size, err := io.CopyN(writer, file, partSize)
+
+		if size > 0 {
+			us.Parts = append(us.Parts, UploadPart{
+				Number: number,
+				SHA256: hex.EncodeToString(partHash.Sum(nil)),
+				Size:   size})
+
+			us.Size += size
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if payloadHash != nil {
+		us.SHA256 = hex.EncodeToString(payloadHash.Sum(nil))
+	}
+
+	return us, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func loadUploadSession(digest string) (*UploadSession, error) {
+	path, err := uploadSessionPath(digest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	us := &UploadSession{}
+
+	if err := json.Unmarshal(data, us); err != nil {
+		return nil, err
+	}
+
+	return us, nil
+}
+
+func uploadSessionPath(digest string) (string, error) {
+	path, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(path, ".waldo", "uploads", digest+".json"), nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (us *UploadSession) isResumableBy(other *UploadSession) bool {
+	return other != nil &&
+		len(other.UploadID) > 0 &&
+		other.BuildURL == us.BuildURL &&
+		other.PartSize == us.PartSize &&
+		other.SHA256 == us.SHA256
+}
+
+func (us *UploadSession) manifest() ([]byte, error) {
+	return json.Marshal(&UploadSessionStatus{
+		Parts: us.Parts})
+}
+
+func (us *UploadSession) missingParts(status *UploadSessionStatus) []UploadPart {
+	received := map[int]string{}
+
+	for _, part := range status.Parts {
+		received[part.Number] = part.SHA256
+	}
+
+	var parts []UploadPart
+
+	for _, part := range us.Parts {
+		if received[part.Number] != part.SHA256 {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+func (us *UploadSession) partOffset(part UploadPart) int64 {
+	return int64(part.Number-1) * us.PartSize
+}
+
+func (us *UploadSession) remove() error {
+	path, err := uploadSessionPath(us.SHA256)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func (us *UploadSession) save() error {
+	path, err := uploadSessionPath(us.SHA256)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(us)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+func (us *UploadSession) sessionURL() string {
+	return us.BuildURL + "/uploads/" + us.UploadID
+}
+
+//-----------------------------------------------------------------------------
+
+func (ua *uploadAction) completeUploadSession(us *UploadSession, retryAllowed bool) (bool, error) {
+	url := us.sessionURL() + "/complete?" + ua.makeBuildQuery()
+
+	body, err := us.manifest()
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, url)
+	}
+
+	resp, err := ua.sendSessionRequest("POST", url, bytes.NewReader(body), int64(len(body)), jsonContentType, nil)
+
+	if err != nil {
+		return retryAllowed && shouldRetryError(err, true), ua.wrapUploadError("build", err, url)
+	}
+
+	defer resp.Body.Close()
+
+	if err := ua.checkBuildStatus(resp); err != nil {
+		ua.recordFailure(resp)
+
+		return retryAllowed && shouldRetry(resp), err
+	}
+
+	ua.saveUploadMetadata(resp)
+
+	if err := us.remove(); err != nil {
+		emitError(fmt.Errorf("Unable to remove upload session locally, error: %v", err))
+	}
+
+	return false, nil
+}
+
+// A session that the server expired or dropped is reported as not found,
+// rather than as an error, so that a new one can be opened in its place.
+func (ua *uploadAction) fetchUploadSessionStatus(us *UploadSession, retryAllowed bool) (*UploadSessionStatus, bool, bool, error) {
+	url := us.sessionURL()
+
+	resp, err := ua.sendSessionRequest("GET", url, nil, 0, "", nil)
+
+	if err != nil {
+		return nil, false, retryAllowed && shouldRetryError(err, true), ua.wrapUploadError("build", err, url)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, false, false, nil
+	}
+
+	if err := ua.checkBuildStatus(resp); err != nil {
+		ua.recordFailure(resp)
+
+		return nil, true, retryAllowed && shouldRetry(resp), err
+	}
+
+	status := &UploadSessionStatus{}
+
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, true, retryAllowed, ua.wrapUploadError("build", err, url)
+	}
+
+	return status, true, false, nil
+}
+
+func (ua *uploadAction) openUploadSession(us *UploadSession, retryAllowed bool) (bool, error) {
+	url := us.BuildURL + "/uploads"
+
+	body, err := json.Marshal(map[string]any{
+		"contentType": us.ContentType,
+		"partSize":    us.PartSize,
+		"sha256":      us.SHA256,
+		"size":        us.Size})
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, url)
+	}
+
+	resp, err := ua.sendSessionRequest("POST", url, bytes.NewReader(body), int64(len(body)), jsonContentType, nil)
+
+	if err != nil {
+		return retryAllowed && shouldRetryError(err, false), ua.wrapUploadError("build", err, url)
+	}
+
+	defer resp.Body.Close()
+
+	if err := ua.checkBuildStatus(resp); err != nil {
+		ua.recordFailure(resp)
+
+		return retryAllowed && shouldRetryNonIdempotent(resp), err
+	}
+
+	return false, nil
+}
+
+// Hashes the payload and opens its upload session once per invocation, so
+// that a retry only asks the server for the parts it is missing. A session
+// that a previous invocation opened for the same payload, partitioning and
+// build endpoint is resumed instead of opened again.
+func (ua *uploadAction) prepareUploadSession(retryAllowed bool) (*UploadSession, bool, error) {
+	if ua.uploadSession != nil {
+		return ua.uploadSession, false, nil
+	}
+
+	us, err := newUploadSession(ua.absBuildPayloadPath, ua.payloadSHA256, ua.makeBuildEndpoint(), ua.buildContentType(), ua.uploadPartSize)
+
+	if err != nil {
+		return nil, false, ua.wrapUploadError("build", err, ua.makeBuildURL())
+	}
+
+	ua.payloadSHA256 = us.SHA256
+
+	saved, err := loadUploadSession(us.SHA256)
+
+	if err != nil {
+		emitError(fmt.Errorf("Unable to load upload session locally, error: %v", err))
+	}
+
+	if us.isResumableBy(saved) {
+		fmt.Printf("Resuming upload %s…\n", saved.UploadID)
+
+		us.UploadID = saved.UploadID
+		ua.uploadID = us.UploadID
+		ua.uploadSession = us
+
+		return us, false, nil
+	}
+
+	us.UploadID = ua.uploadID
+
+	if retry, err := ua.startUploadSession(us, retryAllowed); err != nil {
+		return nil, retry, err
+	}
+
+	return us, false, nil
+}
+
+// Forgets a session that the server no longer has, both locally and for
+// this invocation, and opens a new one with a new upload ID.
+func (ua *uploadAction) restartUploadSession(us *UploadSession, retryAllowed bool) (bool, error) {
+	fmt.Printf("Upload %s expired -- starting a new one…\n", us.UploadID)
+
+	ua.uploadSession = nil
+
+	if err := us.remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		emitError(fmt.Errorf("Unable to remove upload session locally, error: %v", err))
+	}
+
+	ua.uploadID = randomUploadID()
+	us.UploadID = ua.uploadID
+
+	return ua.startUploadSession(us, retryAllowed)
+}
+
+func (ua *uploadAction) sendSessionRequest(method, url string, body io.Reader, contentLength int64, contentType string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.ContentLength = contentLength
+
+	req.Header.Add("Authorization", ua.authorization())
+	req.Header.Add("User-Agent", ua.userAgent())
+	req.Header.Add("X-Upload-Id", ua.uploadID)
+
+	if len(contentType) > 0 {
+		req.Header.Add("Content-Type", contentType)
+	}
+
+	for key, value := range headers {
+		req.Header.Add(key, value)
+	}
+
+	dumpRequest(ua.userVerbose, req, false)
+
+	resp, err := ua.sendRequest(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dumpResponse(ua.userVerbose, resp, method != "PUT")
+
+	return resp, nil
+}
+
+// Opens the session on the server, then saves it so that a later invocation
+// can resume it.
+func (ua *uploadAction) startUploadSession(us *UploadSession, retryAllowed bool) (bool, error) {
+	if retry, err := ua.openUploadSession(us, retryAllowed); err != nil {
+		return retry, err
+	}
+
+	if err := us.save(); err != nil {
+		emitError(fmt.Errorf("Unable to save upload session locally, error: %v", err))
+	}
+
+	ua.uploadSession = us
+
+	return false, nil
+}
+
+func (ua *uploadAction) uploadBuildChunked(retryAllowed bool) (bool, error) {
+	fmt.Printf("Uploading build to Waldo in parts…\n")
+
+	return ua.uploadBuildSession(retryAllowed, ua.uploadBuildPartsInOrder)
+}
+
+func (ua *uploadAction) uploadBuildPart(file *os.File, us *UploadSession, part UploadPart, retryAllowed bool) (bool, error) {
+	url := us.sessionURL() + "/parts/" + strconv.Itoa(part.Number)
+
+	digest, err := hex.DecodeString(part.SHA256)
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, url)
+	}
+
+	headers := map[string]string{
+		"Content-Digest": "sha-256=:" + base64.StdEncoding.EncodeToString(digest) + ":"}
+
+	section := io.NewSectionReader(file, us.partOffset(part), part.Size)
+
+	resp, err := ua.sendSessionRequest("PUT", url, ua.bodyReader(section), part.Size, binaryContentType, headers)
+
+	if err != nil {
+		ua.discardProgress(section)
+
+		return retryAllowed && shouldRetryError(err, true), ua.wrapUploadError("build", err, url)
+	}
+
+	defer resp.Body.Close()
+
+	if err := ua.checkBuildStatus(resp); err != nil {
+		ua.discardProgress(section)
+		ua.recordFailure(resp)
+
+		return retryAllowed && shouldRetry(resp), err
+	}
+
+	return false, nil
+}
+
+func (ua *uploadAction) uploadBuildPartsInOrder(file *os.File, us *UploadSession, parts []UploadPart, retryAllowed bool) (bool, error) {
+	for _, part := range parts {
+		if retry, err := ua.uploadBuildPart(file, us, part, retryAllowed); err != nil {
+			return retry, err
+		}
+	}
+
+	return false, nil
+}
+
+// Uploads the parts the server is missing with the given uploader, then
+// completes the session with the manifest of all part checksums.
+func (ua *uploadAction) uploadBuildSession(retryAllowed bool, uploadParts partUploader) (bool, error) {
+	us, retry, err := ua.prepareUploadSession(retryAllowed)
+
+	if err != nil {
+		return retry, err
+	}
+
+	status, found, retry, err := ua.fetchUploadSessionStatus(us, retryAllowed)
+
+	if err != nil {
+		return retry, err
+	}
+
+	if !found {
+		if retry, err := ua.restartUploadSession(us, retryAllowed); err != nil {
+			return retry, err
+		}
+
+		status = &UploadSessionStatus{}
+	}
+
+	file, err := os.Open(ua.absBuildPayloadPath)
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, us.sessionURL())
+	}
+
+	defer file.Close()
+
+	parts := us.missingParts(status)
+
+	var size int64
+
+	for _, part := range parts {
+		size += part.Size
+	}
+
+	ua.startProgress(size)
+
+	retry, err = uploadParts(file, us, parts, retryAllowed)
+
+	ua.progress.finish()
+
+	if err != nil {
+		return retry, err
+	}
+
+	return ua.completeUploadSession(us, retryAllowed)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Stands in for the upload session endpoints of the Waldo API.
+type testUploadServer struct {
+	failCount   int
+	failPart    int
+	failSticky  bool
+	mutex       sync.Mutex
+	openCount   int
+	parts       map[string]map[int][]byte
+	putParts    []int
+	uploadIDs   []string
+	uploadBytes []byte
+}
+
+func (tus *testUploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tus.mutex.Lock()
+	defer tus.mutex.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/versions/uploads")
+	uploadID := r.Header.Get("X-Upload-Id")
+
+	switch {
+	case r.Method == "POST" && len(path) == 0:
+		tus.openCount++
+
+		if tus.parts[uploadID] == nil {
+			tus.parts[uploadID] = map[int][]byte{}
+			tus.uploadIDs = append(tus.uploadIDs, uploadID)
+
+			w.WriteHeader(http.StatusCreated)
+		}
+
+	case r.Method == "GET" && path == "/"+uploadID:
+		if tus.parts[uploadID] == nil {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		var status UploadSessionStatus
+
+		for number, data := range tus.parts[uploadID] {
+			status.Parts = append(status.Parts, UploadPart{
+				Number: number,
+				SHA256: testSHA256(data),
+				Size:   int64(len(data))})
+		}
+
+		json.NewEncoder(w).Encode(&status)
+
+	case r.Method == "PUT" && strings.HasPrefix(path, "/"+uploadID+"/parts/"):
+		number, _ := strconv.Atoi(strings.TrimPrefix(path, "/"+uploadID+"/parts/"))
+
+		if number == tus.failPart {
+			if !tus.failSticky {
+				tus.failPart = 0
+			}
+
+			tus.failCount++
+
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		data, _ := io.ReadAll(r.Body)
+
+		tus.parts[uploadID][number] = data
+		tus.putParts = append(tus.putParts, number)
+
+	case r.Method == "POST" && path == "/"+uploadID+"/complete":
+		var manifest UploadSessionStatus
+
+		json.NewDecoder(r.Body).Decode(&manifest)
+
+		tus.uploadBytes = nil
+
+		for _, part := range manifest.Parts {
+			data := tus.parts[uploadID][part.Number]
+
+			if testSHA256(data) != part.SHA256 {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			tus.uploadBytes = append(tus.uploadBytes, data...)
+		}
+
+		w.Write([]byte(`{"applicationId":"app-1","id":"appv-1"}`))
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestUploadAction(t *testing.T, serverURL, payloadPath, uploadMode string) *uploadAction {
+	ua := newUploadAction(payloadPath, "token", "", "", "", "", false, map[string]string{
+		"apiBuildEndpoint": serverURL + "/versions"})
+
+	ua.setRetryPolicy(newRetryPolicy(2, time.Millisecond, time.Millisecond))
+	ua.setUploadMode(uploadMode)
+
+	ua.absBuildPath = payloadPath
+	ua.absBuildPayloadPath = payloadPath
+	ua.buildInfo = &buildInfo{}
+	ua.buildSuffix = "apk"
+	ua.ciInfo = &ciInfo{}
+	ua.flavor = "Android"
+	ua.gitInfo = &gitInfo{access: ok}
+	ua.uploadID = randomUploadID()
+	ua.uploadPartSize = 1024
+
+	return ua
+}
+
+func testSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func writeTestPayload(t *testing.T, size int) (string, []byte) {
+	payload := make([]byte, size)
+
+	for idx := range payload {
+		payload[idx] = byte(idx * 7)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.apk")
+
+	if err := os.WriteFile(path, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, payload
+}
+
+//-----------------------------------------------------------------------------
+
+func TestUploadBuildChunkedResume(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tus := &testUploadServer{
+		failPart: 2,
+		parts:    map[string]map[int][]byte{}}
+
+	server := httptest.NewServer(tus)
+
+	defer server.Close()
+
+	payloadPath, payload := writeTestPayload(t, 2500)
+
+	// The first invocation drops out after the first part…
+	first := newTestUploadAction(t, server.URL, payloadPath, "chunked")
+
+	if _, err := first.uploadBuildChunked(false); err == nil {
+		t.Fatal("First upload should fail")
+	}
+
+	if first.progress.sent != 1024 {
+		t.Errorf("Expected only the part received to count as sent, got %d", first.progress.sent)
+	}
+
+	// …and the second one resumes the same session from the second part.
+	ua := newTestUploadAction(t, server.URL, payloadPath, "chunked")
+
+	if _, err := ua.uploadBuildChunked(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tus.uploadIDs) != 1 || ua.uploadID != tus.uploadIDs[0] || tus.openCount != 1 {
+		t.Errorf("Expected a single upload session opened once, got %q opened %d times", tus.uploadIDs, tus.openCount)
+	}
+
+	if !slices.Equal(tus.putParts, []int{1, 2, 3}) {
+		t.Errorf("Expected each part to be sent once, got %v", tus.putParts)
+	}
+
+	if !bytes.Equal(tus.uploadBytes, payload) {
+		t.Error("Uploaded bytes do not match payload")
+	}
+
+	if ua.uploadMetadata == nil || ua.uploadMetadata.AppVersionID != "appv-1" {
+		t.Errorf("Unexpected upload metadata: %+v", ua.uploadMetadata)
+	}
+
+	if saved, _ := loadUploadSession(testSHA256(payload)); saved != nil {
+		t.Error("Upload session should be removed once complete")
+	}
+}
+
+func TestUploadBuildChunkedResumeExpired(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tus := &testUploadServer{
+		failPart: 2,
+		parts:    map[string]map[int][]byte{}}
+
+	server := httptest.NewServer(tus)
+
+	defer server.Close()
+
+	payloadPath, payload := writeTestPayload(t, 2500)
+
+	if _, err := newTestUploadAction(t, server.URL, payloadPath, "chunked").uploadBuildChunked(false); err == nil {
+		t.Fatal("First upload should fail")
+	}
+
+	// The server drops the session the first invocation saved…
+	tus.parts = map[string]map[int][]byte{}
+	tus.putParts = nil
+
+	// …so the second one starts a new session instead of failing for good.
+	ua := newTestUploadAction(t, server.URL, payloadPath, "chunked")
+
+	if _, err := ua.uploadBuildChunked(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tus.uploadIDs) != 2 || ua.uploadID != tus.uploadIDs[1] {
+		t.Errorf("Expected a new upload session, got %q", tus.uploadIDs)
+	}
+
+	if !slices.Equal(tus.putParts, []int{1, 2, 3}) {
+		t.Errorf("Expected each part to be sent again, got %v", tus.putParts)
+	}
+
+	if !bytes.Equal(tus.uploadBytes, payload) {
+		t.Error("Uploaded bytes do not match payload")
+	}
+
+	if saved, _ := loadUploadSession(testSHA256(payload)); saved != nil {
+		t.Error("Upload session should be removed once complete")
+	}
+}
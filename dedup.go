@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Asks Waldo to link the git and CI metadata of this invocation to a build it
+// already has with the same payload digest, so that nothing else needs to be
+// sent. Any other answer falls back to a regular upload.
+func (ua *uploadAction) linkExistingBuild() bool {
+	if ua.isStreamingPayload() {
+		return false
+	}
+
+	digest, size, err := hashFile(ua.absBuildPayloadPath)
+
+	if err != nil {
+		emitError(fmt.Errorf("Unable to compute build digest, error: %v", err))
+
+		return false
+	}
+
+	ua.payloadSHA256 = digest
+
+	url := ua.makeBuildEndpoint() + "/links?" + ua.makeBuildQuery()
+
+	body, err := json.Marshal(map[string]any{
+		"contentType": ua.buildContentType(),
+		"sha256":      digest,
+		"size":        size})
+
+	if err != nil {
+		return false
+	}
+
+	resp, err := ua.sendSessionRequest("POST", url, bytes.NewReader(body), int64(len(body)), jsonContentType, nil)
+
+	if err != nil {
+		emitError(ua.wrapUploadError("build link", err, url))
+
+		return false
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false // unknown digest, or a server without deduplication
+	}
+
+	fmt.Printf("Build already uploaded to Waldo -- linking it…\n")
+
+	ua.payloadLinked = true
+
+	ua.saveUploadMetadata(resp)
+
+	return true
+}
+
+//-----------------------------------------------------------------------------
+
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(hash, file)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
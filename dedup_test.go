@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLinkExistingBuild(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	payloadPath, payload := writeTestPayload(t, 2500)
+	knownDigest := testSHA256(payload)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SHA256 string `json:"sha256"`
+		}
+
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if r.Method != "POST" || r.URL.Path != "/versions/links" || body.SHA256 != knownDigest {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Write([]byte(`{"applicationId":"app-1","id":"appv-1"}`))
+	}))
+
+	defer server.Close()
+
+	ua := newTestUploadAction(t, server.URL, payloadPath, "")
+
+	if !ua.linkExistingBuild() {
+		t.Fatal("Expected build to be linked")
+	}
+
+	um := ua.uploadMetadata
+
+	if um == nil || um.AppVersionID != "appv-1" || !um.Linked || um.SHA256 != knownDigest {
+		t.Errorf("Unexpected upload metadata: %+v", um)
+	}
+
+	// An unknown digest falls back to a regular upload.
+	knownDigest = "unknown"
+
+	if newTestUploadAction(t, server.URL, payloadPath, "").linkExistingBuild() {
+		t.Error("Expected unknown build not to be linked")
+	}
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FastCDC parameters: cut points are searched for between the minimum and
+// maximum chunk sizes, with a stricter mask before the average size and a
+// looser one after it, so that chunk sizes cluster around the average.
+const (
+	deltaChunkAvgSize = 64 * 1024
+	deltaChunkMaxSize = 256 * 1024
+	deltaChunkMinSize = 16 * 1024
+	deltaMaskLarge    = (1<<14 - 1) << (64 - 14)
+	deltaMaskSmall    = (1<<18 - 1) << (64 - 18)
+)
+
+//-----------------------------------------------------------------------------
+
+type DeltaChunk struct {
+	Offset int64  `json:"-"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type DeltaChunkStatus struct {
+	Chunks  []string `json:"chunks,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Only describes what the server holds for one app and variant, so it is
+// keyed by those rather than by the build URL, which apps can share.
+type DeltaIndex struct {
+	BuildURL string   `json:"buildURL"`
+	Chunks   []string `json:"chunks"`
+	Key      string   `json:"key"`
+}
+
+type DeltaRecipe struct {
+	Chunks      []DeltaChunk `json:"chunks"`
+	ContentType string       `json:"contentType"`
+	SHA256      string       `json:"sha256"`
+	Size        int64        `json:"size"`
+}
+
+//-----------------------------------------------------------------------------
+
+// Must never change: chunk boundaries, and therefore chunk hashes, are only
+// comparable between builds chunked with the same table.
+var deltaGear = makeDeltaGear()
+
+//-----------------------------------------------------------------------------
+
+func newDeltaIndex(buildURL, key string) *DeltaIndex {
+	return &DeltaIndex{
+		BuildURL: buildURL,
+		Key:      key}
+}
+
+// Splits the payload into content-defined chunks, so that an insertion or
+// deletion only changes the chunks around it rather than every chunk after.
+func newDeltaRecipe(payloadPath, contentType string) (*DeltaRecipe, error) {
+	file, err := os.Open(payloadPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	dr := &DeltaRecipe{
+		ContentType: contentType}
+
+	payloadHash := sha256.New()
+	reader := bufio.NewReaderSize(file, deltaChunkMaxSize)
+	buf := make([]byte, deltaChunkMaxSize)
+	filled := 0
+
+	for {
+		n, err := io.ReadFull(reader, buf[filled:])
+
+		filled += n
+
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+
+		if filled == 0 {
+			break
+		}
+
+		size := findDeltaCutPoint(buf[:filled])
+		sum := sha256.Sum256(buf[:size])
+
+		payloadHash.Write(buf[:size])
+
+		dr.Chunks = append(dr.Chunks, DeltaChunk{
+			Offset: dr.Size,
+			SHA256: hex.EncodeToString(sum[:]),
+			Size:   int64(size)})
+
+		dr.Size += int64(size)
+
+		filled = copy(buf, buf[size:filled])
+	}
+
+	dr.SHA256 = hex.EncodeToString(payloadHash.Sum(nil))
+
+	return dr, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func deltaIndexPath(key string) (string, error) {
+	path, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(path, ".waldo", "chunks", key[:16]+".json"), nil
+}
+
+// Returns the length of the first chunk of the data, using a gear rolling
+// hash to find a content-defined cut point.
+func findDeltaCutPoint(data []byte) int {
+	size := len(data)
+
+	if size <= deltaChunkMinSize {
+		return size
+	}
+
+	size = min(size, deltaChunkMaxSize)
+	normalSize := min(size, deltaChunkAvgSize)
+
+	var hash uint64
+
+	idx := deltaChunkMinSize
+
+	for ; idx < normalSize; idx++ {
+		if hash = hash<<1 + deltaGear[data[idx]]; hash&deltaMaskSmall == 0 {
+			return idx + 1
+		}
+	}
+
+	for ; idx < size; idx++ {
+		if hash = hash<<1 + deltaGear[data[idx]]; hash&deltaMaskLarge == 0 {
+			return idx + 1
+		}
+	}
+
+	return size
+}
+
+func loadDeltaIndex(buildURL, key string) (*DeltaIndex, error) {
+	path, err := deltaIndexPath(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return newDeltaIndex(buildURL, key), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	di := &DeltaIndex{}
+
+	if err := json.Unmarshal(data, di); err != nil {
+		return nil, err
+	}
+
+	if di.BuildURL != buildURL || di.Key != key {
+		return newDeltaIndex(buildURL, key), nil
+	}
+
+	return di, nil
+}
+
+// The key is a digest, so that the upload token is not written to disk.
+func makeDeltaIndexKey(buildURL, uploadToken, appID, variantName string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{buildURL, uploadToken, appID, variantName}, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Fills the gear table from a fixed-seed SplitMix64 sequence.
+func makeDeltaGear() [256]uint64 {
+	var gear [256]uint64
+
+	seed := uint64(0x5741_4c44_4f21) // "WALDO!"
+
+	for idx := range gear {
+		seed += 0x9e3779b97f4a7c15
+
+		value := seed
+		value = (value ^ value>>30) * 0xbf58476d1ce4e5b9
+		value = (value ^ value>>27) * 0x94d049bb133111eb
+
+		gear[idx] = value ^ value>>31
+	}
+
+	return gear
+}
+
+//-----------------------------------------------------------------------------
+
+func (di *DeltaIndex) remove() error {
+	path, err := deltaIndexPath(di.Key)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func (di *DeltaIndex) save() error {
+	path, err := deltaIndexPath(di.Key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(di)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+//-----------------------------------------------------------------------------
+
+func (dr *DeltaRecipe) uniqueChunks() []DeltaChunk {
+	seen := map[string]bool{}
+
+	var chunks []DeltaChunk
+
+	for _, chunk := range dr.Chunks {
+		if !seen[chunk.SHA256] {
+			seen[chunk.SHA256] = true
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	return chunks
+}
+
+//-----------------------------------------------------------------------------
+
+// Sends the recipe; the server assembles the payload from the chunks of this
+// and earlier builds. A conflict means that it no longer has some chunks the
+// local index claims it has, so the index is dropped.
+func (ua *uploadAction) completeDeltaUpload(dr *DeltaRecipe, di *DeltaIndex, retryAllowed bool) (bool, bool, bool, error) {
+	url := di.BuildURL + "/deltas?" + ua.makeBuildQuery()
+
+	body, err := json.Marshal(dr)
+
+	if err != nil {
+		return false, false, false, ua.wrapUploadError("build", err, url)
+	}
+
+	resp, err := ua.sendSessionRequest("POST", url, bytes.NewReader(body), int64(len(body)), jsonContentType, nil)
+
+	if err != nil {
+		return false, false, retryAllowed && shouldRetryError(err, true), ua.wrapUploadError("build", err, url)
+	}
+
+	defer resp.Body.Close()
+
+	if isDeltaUnsupported(resp) {
+		return false, false, false, nil
+	}
+
+	if err := ua.checkBuildStatus(resp); err != nil {
+		ua.recordFailure(resp)
+
+		if resp.StatusCode == http.StatusConflict {
+			if err := di.remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+				emitError(fmt.Errorf("Unable to remove chunk index locally, error: %v", err))
+			}
+
+			di.Chunks = nil
+
+			return true, true, retryAllowed, err
+		}
+
+		return true, false, retryAllowed && shouldRetry(resp), err
+	}
+
+	ua.saveUploadMetadata(resp)
+
+	di.Chunks = nil
+
+	for _, chunk := range dr.uniqueChunks() {
+		di.Chunks = append(di.Chunks, chunk.SHA256)
+	}
+
+	if err := di.save(); err != nil {
+		emitError(fmt.Errorf("Unable to save chunk index locally, error: %v", err))
+	}
+
+	return true, false, false, nil
+}
+
+// Asks the server which of the chunks it is missing, leaving out those the
+// local index says it received with the previous build.
+func (ua *uploadAction) findMissingDeltaChunks(dr *DeltaRecipe, di *DeltaIndex, retryAllowed bool) ([]DeltaChunk, bool, bool, error) {
+	known := makeSet(di.Chunks)
+
+	var unknown []DeltaChunk
+
+	for _, chunk := range dr.uniqueChunks() {
+		if !known[chunk.SHA256] {
+			unknown = append(unknown, chunk)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil, true, false, nil
+	}
+
+	url := di.BuildURL + "/chunks/missing"
+
+	query := &DeltaChunkStatus{}
+
+	for _, chunk := range unknown {
+		query.Chunks = append(query.Chunks, chunk.SHA256)
+	}
+
+	body, err := json.Marshal(query)
+
+	if err != nil {
+		return nil, false, false, ua.wrapUploadError("build", err, url)
+	}
+
+	resp, err := ua.sendSessionRequest("POST", url, bytes.NewReader(body), int64(len(body)), jsonContentType, nil)
+
+	if err != nil {
+		return nil, false, retryAllowed && shouldRetryError(err, true), ua.wrapUploadError("build", err, url)
+	}
+
+	defer resp.Body.Close()
+
+	if isDeltaUnsupported(resp) {
+		return nil, false, false, nil
+	}
+
+	if err := ua.checkBuildStatus(resp); err != nil {
+		ua.recordFailure(resp)
+
+		return nil, true, retryAllowed && shouldRetry(resp), err
+	}
+
+	status := &DeltaChunkStatus{}
+
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, true, retryAllowed, ua.wrapUploadError("build", err, url)
+	}
+
+	wanted := makeSet(status.Missing)
+
+	var missing []DeltaChunk
+
+	for _, chunk := range unknown {
+		if wanted[chunk.SHA256] {
+			missing = append(missing, chunk)
+		}
+	}
+
+	return missing, true, false, nil
+}
+
+func (ua *uploadAction) uploadBuildDelta(retryAllowed bool) (bool, error) {
+	fmt.Printf("Uploading build delta to Waldo…\n")
+
+	url := ua.makeBuildEndpoint()
+
+	dr, err := newDeltaRecipe(ua.absBuildPayloadPath, ua.buildContentType())
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, url)
+	}
+
+	key := makeDeltaIndexKey(url, ua.userUploadToken, ua.userAppID, ua.userVariantName)
+
+	di, err := loadDeltaIndex(url, key)
+
+	if err != nil {
+		emitError(fmt.Errorf("Unable to load chunk index locally, error: %v", err))
+
+		di = newDeltaIndex(url, key)
+	}
+
+	// A conflict leaves the index empty, so asking the server again for the
+	// missing chunks is enough to recover from it, without spending a retry.
+	for renegotiated := false; ; renegotiated = true {
+		missing, supported, retry, err := ua.findMissingDeltaChunks(dr, di, retryAllowed)
+
+		if err != nil {
+			return retry, err
+		}
+
+		if !supported {
+			break
+		}
+
+		if retry, err := ua.uploadDeltaChunks(dr, di, missing, retryAllowed); err != nil {
+			return retry, err
+		}
+
+		supported, conflict, retry, err := ua.completeDeltaUpload(dr, di, retryAllowed)
+
+		if conflict && !renegotiated {
+			fmt.Printf("\nChunk index is out of date -- asking server for missing chunks again…\n\n")
+
+			continue
+		}
+
+		if supported || err != nil {
+			return retry, err
+		}
+
+		break
+	}
+
+	fmt.Printf("\nServer does not support delta uploads -- uploading the whole build…\n\n")
+
+	return ua.uploadBuild(retryAllowed)
+}
+
+func (ua *uploadAction) uploadDeltaChunk(file *os.File, di *DeltaIndex, chunk DeltaChunk, retryAllowed bool) (bool, error) {
+	url := di.BuildURL + "/chunks/" + chunk.SHA256
+
+	digest, err := hex.DecodeString(chunk.SHA256)
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, url)
+	}
+
+	headers := map[string]string{
+		"Content-Digest": "sha-256=:" + base64.StdEncoding.EncodeToString(digest) + ":"}
+
+	section := io.NewSectionReader(file, chunk.Offset, chunk.Size)
+
+	resp, err := ua.sendSessionRequest("PUT", url, ua.bodyReader(section), chunk.Size, binaryContentType, headers)
+
+	if err != nil {
+		ua.discardProgress(section)
+
+		return retryAllowed && shouldRetryError(err, true), ua.wrapUploadError("build", err, url)
+	}
+
+	defer resp.Body.Close()
+
+	if err := ua.checkBuildStatus(resp); err != nil {
+		ua.discardProgress(section)
+		ua.recordFailure(resp)
+
+		return retryAllowed && shouldRetry(resp), err
+	}
+
+	return false, nil
+}
+
+func (ua *uploadAction) uploadDeltaChunks(dr *DeltaRecipe, di *DeltaIndex, chunks []DeltaChunk, retryAllowed bool) (bool, error) {
+	var size int64
+
+	for _, chunk := range chunks {
+		size += chunk.Size
+	}
+
+	fmt.Printf("Sending %d of %d chunks (%d of %d bytes)…\n", len(chunks), len(dr.Chunks), size, dr.Size)
+
+	file, err := os.Open(ua.absBuildPayloadPath)
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, di.BuildURL)
+	}
+
+	defer file.Close()
+
+	ua.startProgress(size)
+
+	defer ua.progress.finish()
+
+	for _, chunk := range chunks {
+		if retry, err := ua.uploadDeltaChunk(file, di, chunk, retryAllowed); err != nil {
+			return retry, err
+		}
+	}
+
+	return false, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func isDeltaUnsupported(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+
+	default:
+		return false
+	}
+}
+
+func makeSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+
+	for _, value := range values {
+		set[value] = true
+	}
+
+	return set
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Stands in for the delta endpoints of the Waldo API, or for a server that
+// only accepts whole builds.
+type testDeltaServer struct {
+	chunks      map[string][]byte
+	mutex       sync.Mutex
+	putChunks   int
+	unsupported bool
+	uploadBytes []byte
+}
+
+func (tds *testDeltaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tds.mutex.Lock()
+	defer tds.mutex.Unlock()
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/versions":
+		tds.uploadBytes, _ = io.ReadAll(r.Body)
+
+		w.Write([]byte(`{"applicationId":"app-1","id":"appv-1"}`))
+
+	case tds.unsupported:
+		w.WriteHeader(http.StatusNotFound)
+
+	case r.Method == "POST" && r.URL.Path == "/versions/chunks/missing":
+		var query, status DeltaChunkStatus
+
+		json.NewDecoder(r.Body).Decode(&query)
+
+		for _, digest := range query.Chunks {
+			if tds.chunks[digest] == nil {
+				status.Missing = append(status.Missing, digest)
+			}
+		}
+
+		json.NewEncoder(w).Encode(&status)
+
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/versions/chunks/"):
+		data, _ := io.ReadAll(r.Body)
+
+		tds.chunks[strings.TrimPrefix(r.URL.Path, "/versions/chunks/")] = data
+		tds.putChunks++
+
+	case r.Method == "POST" && r.URL.Path == "/versions/deltas":
+		var recipe DeltaRecipe
+
+		json.NewDecoder(r.Body).Decode(&recipe)
+
+		tds.uploadBytes = nil
+
+		for _, chunk := range recipe.Chunks {
+			data := tds.chunks[chunk.SHA256]
+
+			if data == nil {
+				w.WriteHeader(http.StatusConflict)
+
+				return
+			}
+
+			tds.uploadBytes = append(tds.uploadBytes, data...)
+		}
+
+		w.Write([]byte(`{"applicationId":"app-1","id":"appv-2"}`))
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func makeTestDeltaPayload(size int) []byte {
+	payload := make([]byte, size)
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for idx := range payload {
+		payload[idx] = byte(rng.Uint32())
+	}
+
+	return payload
+}
+
+func writeTestDeltaPayload(t *testing.T, payload []byte) string {
+	path := filepath.Join(t.TempDir(), "app.apk")
+
+	if err := os.WriteFile(path, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+//-----------------------------------------------------------------------------
+
+func TestLoadDeltaIndex(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	url := "https://api.waldo.com/versions"
+	key := makeDeltaIndexKey(url, "token-1", "app-1", "")
+
+	di := newDeltaIndex(url, key)
+
+	di.Chunks = []string{"abc"}
+
+	if err := di.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if di, err := loadDeltaIndex(url, key); err != nil || len(di.Chunks) != 1 {
+		t.Errorf("Expected saved chunk index, got %+v, %v", di, err)
+	}
+
+	// Apps and variants sharing the build endpoint get their own index.
+	for _, other := range []string{makeDeltaIndexKey(url, "token-2", "app-2", ""), makeDeltaIndexKey(url, "token-1", "app-1", "debug")} {
+		if di, err := loadDeltaIndex(url, other); err != nil || len(di.Chunks) != 0 {
+			t.Errorf("Expected empty chunk index, got %+v, %v", di, err)
+		}
+	}
+}
+
+func TestNewDeltaRecipe(t *testing.T) {
+	payload := makeTestDeltaPayload(2 * 1024 * 1024)
+	edited := append(append(append([]byte{}, payload[:1024*1024]...), []byte("inserted")...), payload[1024*1024:]...)
+
+	before, err := newDeltaRecipe(writeTestDeltaPayload(t, payload), binaryContentType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := newDeltaRecipe(writeTestDeltaPayload(t, edited), binaryContentType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if before.SHA256 != testSHA256(payload) || before.Size != int64(len(payload)) {
+		t.Errorf("Unexpected recipe digest or size: %s, %d", before.SHA256, before.Size)
+	}
+
+	for idx, chunk := range before.Chunks {
+		if chunk.Size > deltaChunkMaxSize || (chunk.Size < deltaChunkMinSize && idx < len(before.Chunks)-1) {
+			t.Errorf("Chunk %d has unexpected size %d", idx, chunk.Size)
+		}
+
+		if testSHA256(payload[chunk.Offset:chunk.Offset+chunk.Size]) != chunk.SHA256 {
+			t.Errorf("Chunk %d does not match payload", idx)
+		}
+	}
+
+	known := map[string]bool{}
+
+	for _, chunk := range before.Chunks {
+		known[chunk.SHA256] = true
+	}
+
+	changed := 0
+
+	for _, chunk := range after.Chunks {
+		if !known[chunk.SHA256] {
+			changed++
+		}
+	}
+
+	// Only the chunks around the insertion should differ.
+	if changed > 2 {
+		t.Errorf("Expected at most 2 of %d chunks to change, got %d", len(after.Chunks), changed)
+	}
+}
+
+func TestUploadBuildDelta(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tds := &testDeltaServer{
+		chunks: map[string][]byte{}}
+
+	server := httptest.NewServer(tds)
+
+	defer server.Close()
+
+	payload := makeTestDeltaPayload(1024 * 1024)
+
+	if _, err := newTestUploadAction(t, server.URL, writeTestDeltaPayload(t, payload), "delta").uploadBuildDelta(false); err != nil {
+		t.Fatal(err)
+	}
+
+	firstChunks := tds.putChunks
+
+	// The next build only sends the chunks that changed.
+	copy(payload[512*1024:], "changed")
+
+	ua := newTestUploadAction(t, server.URL, writeTestDeltaPayload(t, payload), "delta")
+
+	if _, err := ua.uploadBuildDelta(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := tds.putChunks - firstChunks; sent < 1 || sent > 2 {
+		t.Errorf("Expected 1 or 2 chunks to be sent, got %d of %d", sent, firstChunks)
+	}
+
+	if !bytes.Equal(tds.uploadBytes, payload) {
+		t.Error("Assembled bytes do not match payload")
+	}
+
+	if ua.uploadMetadata == nil || ua.uploadMetadata.AppVersionID != "appv-2" {
+		t.Errorf("Unexpected upload metadata: %+v", ua.uploadMetadata)
+	}
+}
+
+func TestUploadBuildDeltaConflict(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tds := &testDeltaServer{
+		chunks: map[string][]byte{}}
+
+	server := httptest.NewServer(tds)
+
+	defer server.Close()
+
+	payload := makeTestDeltaPayload(256 * 1024)
+	payloadPath := writeTestDeltaPayload(t, payload)
+
+	if _, err := newTestUploadAction(t, server.URL, payloadPath, "delta").uploadBuildDelta(false); err != nil {
+		t.Fatal(err)
+	}
+
+	firstChunks := tds.putChunks
+
+	// The server lost the chunks the index claims it has; the upload still
+	// succeeds without a retry.
+	tds.chunks = map[string][]byte{}
+
+	if _, err := newTestUploadAction(t, server.URL, payloadPath, "delta").uploadBuildDelta(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := tds.putChunks - firstChunks; sent != firstChunks {
+		t.Errorf("Expected %d chunks to be sent again, got %d", firstChunks, sent)
+	}
+
+	if !bytes.Equal(tds.uploadBytes, payload) {
+		t.Error("Assembled bytes do not match payload")
+	}
+}
+
+func TestUploadBuildDeltaFallback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tds := &testDeltaServer{
+		chunks:      map[string][]byte{},
+		unsupported: true}
+
+	server := httptest.NewServer(tds)
+
+	defer server.Close()
+
+	payload := makeTestDeltaPayload(100 * 1024)
+
+	if _, err := newTestUploadAction(t, server.URL, writeTestDeltaPayload(t, payload), "delta").uploadBuildDelta(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(tds.uploadBytes, payload) {
+		t.Error("Expected the whole build to be uploaded")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+type inspectAction struct {
+	userBuildPath        string
+	userCompressionLevel int
+	userVerbose          bool
+
+	absBuildPath        string
+	absBuildPayloadPath string
+	absWorkingPath      string
+	buildInfo           *buildInfo
+	buildReport         *BuildReport
+	buildSuffix         string
+	flavor              string
+	validated           bool
+}
+
+//-----------------------------------------------------------------------------
+
+func newInspectAction(buildPath string, compressionLevel int, verbose bool) *inspectAction {
+	return &inspectAction{
+		userBuildPath:        buildPath,
+		userCompressionLevel: compressionLevel,
+		userVerbose:          verbose}
+}
+
+//-----------------------------------------------------------------------------
+
+type BuildReport struct {
+	Android             *BuildReportAndroid `json:"android,omitempty"`
+	Apple               *BuildReportApple   `json:"apple,omitempty"`
+	ArchiveCreationDate string              `json:"archiveCreationDate,omitempty"`
+	ArchiveScheme       string              `json:"archiveScheme,omitempty"`
+	BuildPath           string              `json:"buildPath"`
+	BuildSize           int64               `json:"buildSize"`
+	FileCount           int                 `json:"fileCount"`
+	Flavor              string              `json:"flavor"`
+	PayloadSize         int64               `json:"payloadSize"`
+}
+
+type BuildReportAndroid struct {
+	APKSetSelection  []string `json:"apkSetSelection,omitempty"`
+	BundleModules    []string `json:"bundleModules,omitempty"`
+	Debuggable       bool     `json:"debuggable"`
+	LauncherActivity string   `json:"launcherActivity,omitempty"`
+	MinSdkVersion    string   `json:"minSdkVersion,omitempty"`
+	NativeABIs       []string `json:"nativeAbis,omitempty"`
+	PackageName      string   `json:"packageName,omitempty"`
+	SignatureSchemes []string `json:"signatureSchemes,omitempty"`
+	TargetSdkVersion string   `json:"targetSdkVersion,omitempty"`
+	VersionCode      string   `json:"versionCode,omitempty"`
+	VersionName      string   `json:"versionName,omitempty"`
+}
+
+type BuildReportApple struct {
+	Architectures      []string `json:"architectures,omitempty"`
+	BundleExecutable   string   `json:"bundleExecutable,omitempty"`
+	BundleIdentifier   string   `json:"bundleIdentifier,omitempty"`
+	BundleShortVersion string   `json:"bundleShortVersion,omitempty"`
+	BundleVersion      string   `json:"bundleVersion,omitempty"`
+	DeviceFamilies     []string `json:"deviceFamilies,omitempty"`
+	MinimumOSVersion   string   `json:"minimumOSVersion,omitempty"`
+}
+
+//-----------------------------------------------------------------------------
+
+func (br *BuildReport) string() string {
+	if br == nil {
+		return ""
+	}
+
+	data, err := json.MarshalIndent(br, "", "  ")
+
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+//-----------------------------------------------------------------------------
+
+func (ia *inspectAction) buildPath() string {
+	return ia.userBuildPath
+}
+
+func (ia *inspectAction) buildPayloadPath() string {
+	return ia.absBuildPayloadPath
+}
+
+func (ia *inspectAction) report() string {
+	return ia.buildReport.string()
+}
+
+//-----------------------------------------------------------------------------
+
+func (ia *inspectAction) perform() error {
+	err := os.RemoveAll(ia.absWorkingPath)
+
+	if err == nil {
+		err = os.MkdirAll(ia.absWorkingPath, 0755)
+	}
+
+	defer os.RemoveAll(ia.absWorkingPath)
+
+	if err == nil {
+		err = writeBuildPayload(ia.absBuildPayloadPath, ia.absBuildPath, ia.buildSuffix, ia.buildInfo, ia.userCompressionLevel)
+	}
+
+	if err == nil {
+		ia.buildReport, err = ia.makeBuildReport()
+	}
+
+	return err
+}
+
+func (ia *inspectAction) validate() error {
+	if ia.validated {
+		return nil
+	}
+
+	buildPath, buildSuffix, flavor, err := validateBuildPath(ia.userBuildPath)
+
+	if err != nil {
+		return err
+	}
+
+	bi, err := inspectBuildInfo(buildPath, buildSuffix)
+
+	if err != nil {
+		return err
+	}
+
+	workingPath := determineWorkingPath()
+
+	ia.absBuildPath = buildPath
+	ia.absBuildPayloadPath = determineBuildPayloadPath(workingPath, buildPath, buildSuffix, bi)
+	ia.absWorkingPath = workingPath
+	ia.buildInfo = bi
+	ia.buildSuffix = buildSuffix
+	ia.flavor = flavor
+	ia.validated = true
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (ia *inspectAction) makeBuildReport() (*BuildReport, error) {
+	buildSize, err := measurePath(ia.absBuildPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	payloadSize, err := measurePath(ia.absBuildPayloadPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fileCount, err := countZipFiles(ia.absBuildPayloadPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bi := ia.buildInfo
+
+	br := &BuildReport{
+		ArchiveScheme: bi.archiveScheme,
+		BuildPath:     ia.absBuildPath,
+		BuildSize:     buildSize,
+		FileCount:     fileCount,
+		Flavor:        ia.flavor,
+		PayloadSize:   payloadSize}
+
+	if !bi.archiveCreationDate.IsZero() {
+		br.ArchiveCreationDate = bi.archiveCreationDate.Format(time.RFC3339)
+	}
+
+	if am := bi.androidManifest; am != nil {
+		br.Android = &BuildReportAndroid{
+			BundleModules:    bi.bundleModules,
+			Debuggable:       am.debuggable,
+			LauncherActivity: am.launcherActivity,
+			MinSdkVersion:    am.minSdkVersion,
+			NativeABIs:       bi.nativeABIs,
+			PackageName:      am.packageName,
+			SignatureSchemes: bi.signatureSchemes,
+			TargetSdkVersion: am.targetSdkVersion,
+			VersionCode:      am.versionCode,
+			VersionName:      am.versionName}
+
+		if bi.apkSetSelection != nil {
+			br.Android.APKSetSelection = bi.apkSetSelection.paths
+		}
+	}
+
+	if abi := bi.appleBundleInfo; abi != nil {
+		br.Apple = &BuildReportApple{
+			Architectures:      abi.architectures,
+			BundleExecutable:   abi.executable,
+			BundleIdentifier:   abi.identifier,
+			BundleShortVersion: abi.shortVersion,
+			BundleVersion:      abi.version,
+			DeviceFamilies:     abi.deviceFamilies,
+			MinimumOSVersion:   abi.minOSVersion}
+	}
+
+	return br, nil
+}
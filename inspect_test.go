@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestInspectActionAPK(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.apk")
+	data := makeTestAPK(t, androidManifestName, "classes.dex", "lib/x86_64/libfoo.so", "META-INF/MANIFEST.MF", "META-INF/CERT.SF", "META-INF/CERT.RSA")
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ia := newInspectAction(path, defaultCompressionLevel, false)
+
+	if err := ia.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ia.perform(); err != nil {
+		t.Fatal(err)
+	}
+
+	var br BuildReport
+
+	if err := json.Unmarshal([]byte(ia.report()), &br); err != nil {
+		t.Fatal(err)
+	}
+
+	if br.Flavor != "Android" || br.FileCount != 6 || br.BuildSize != int64(len(data)) || br.PayloadSize != br.BuildSize {
+		t.Errorf("Unexpected build facts: %+v", br)
+	}
+
+	if br.Android == nil || br.Apple != nil {
+		t.Fatalf("Unexpected platform facts: %+v", br)
+	}
+
+	if br.Android.PackageName != "com.example.app" || br.Android.VersionCode != "42" {
+		t.Errorf("Unexpected manifest facts: %+v", br.Android)
+	}
+
+	if !slices.Equal(br.Android.NativeABIs, []string{"x86_64"}) || !slices.Equal(br.Android.SignatureSchemes, []string{"v1"}) {
+		t.Errorf("Unexpected APK facts: %+v", br.Android)
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Binaries are opened rather than read, where the bundle allows it, so that
+// large frameworks are not loaded whole into memory.
+type appBundleContents struct {
+	names    []string
+	openFile func(name string) (bundleFile, error)
+	readFile func(name string) ([]byte, error)
+}
+
+type appleBundleInfo struct {
+	architectures  []string
+	deviceFamilies []string
+	executable     string
+	identifier     string
+	minOSVersion   string
+	shortVersion   string
+	version        string
+}
+
+type bufferedBundleFile struct {
+	*bytes.Reader
+}
+
+type bundleFile interface {
+	io.Closer
+	io.ReaderAt
+}
+
+//-----------------------------------------------------------------------------
+
+// Matches the values documented for `UIDeviceFamily`.
+var appleDeviceFamilyNames = map[int64]string{
+	1: "iPhone",
+	2: "iPad",
+	3: "Apple TV",
+	4: "Apple Watch",
+	6: "CarPlay",
+	7: "Apple Vision"}
+
+//-----------------------------------------------------------------------------
+
+func extractAppleBundleInfo(data []byte, hasFile func(name string) bool) (*appleBundleInfo, error) {
+	info, err := parsePlistDict(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	abi := &appleBundleInfo{
+		deviceFamilies: plistDeviceFamilies(info),
+		executable:     plistString(info, "CFBundleExecutable"),
+		identifier:     plistString(info, "CFBundleIdentifier"),
+		minOSVersion:   plistString(info, "MinimumOSVersion"),
+		shortVersion:   plistString(info, "CFBundleShortVersionString"),
+		version:        plistString(info, "CFBundleVersion")}
+
+	if len(abi.executable) == 0 {
+		return nil, errors.New("no CFBundleExecutable")
+	}
+
+	if !hasFile(abi.executable) {
+		return nil, fmt.Errorf("executable %q named by CFBundleExecutable is missing", abi.executable)
+	}
+
+	return abi, nil
+}
+
+func inspectApp(appPath string) (*buildInfo, error) {
+	if !isDir(appPath) {
+		return nil, fmt.Errorf("Unable to read build at %q", appPath)
+	}
+
+	abc, err := newFolderAppBundleContents(appPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read build at %q, error: %v", appPath, err)
+	}
+
+	abi, err := abc.inspect(appPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &buildInfo{
+		appName:         filepath.Base(appPath),
+		appPath:         appPath,
+		appleBundleInfo: abi}, nil
+}
+
+func newFolderAppBundleContents(appPath string) (*appBundleContents, error) {
+	var names []string
+
+	walker := func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		name, err := filepath.Rel(appPath, path)
+
+		if err == nil {
+			names = append(names, filepath.ToSlash(name))
+		}
+
+		return err
+	}
+
+	if err := filepath.WalkDir(appPath, walker); err != nil {
+		return nil, err
+	}
+
+	return &appBundleContents{
+		names: names,
+		openFile: func(name string) (bundleFile, error) {
+			return os.Open(filepath.Join(appPath, filepath.FromSlash(name)))
+		},
+		readFile: func(name string) ([]byte, error) {
+			return os.ReadFile(filepath.Join(appPath, filepath.FromSlash(name)))
+		}}, nil
+}
+
+func newZipAppBundleContents(zr *zip.Reader, appPrefix string) *appBundleContents {
+	var names []string
+
+	files := map[string]*zip.File{}
+
+	for _, file := range zr.File {
+		name, ok := normalizeArchiveEntryName(file.Name)
+
+		if !ok || file.FileInfo().IsDir() || !strings.HasPrefix(name, appPrefix+"/") {
+			continue
+		}
+
+		name = strings.TrimPrefix(name, appPrefix+"/")
+
+		names = append(names, name)
+		files[name] = file
+	}
+
+	return &appBundleContents{
+		names: names,
+		readFile: func(name string) ([]byte, error) {
+			if file, ok := files[name]; ok {
+				return readZipFile(file)
+			}
+
+			return nil, fs.ErrNotExist
+		}}
+}
+
+//-----------------------------------------------------------------------------
+
+func (abc *appBundleContents) binaryNames(executable string) []string {
+	binaryNames := []string{executable}
+
+	var frameworkPaths []string
+
+	for _, name := range abc.names {
+		folder, rest, _ := strings.Cut(name, "/")
+
+		if folder != "Frameworks" {
+			continue
+		}
+
+		if path.Ext(rest) == ".dylib" && !strings.Contains(rest, "/") {
+			binaryNames = append(binaryNames, name)
+
+			continue
+		}
+
+		if frameworkName, _, _ := strings.Cut(rest, "/"); path.Ext(frameworkName) == ".framework" {
+			frameworkPaths = appendIfMissing(frameworkPaths, path.Join(folder, frameworkName))
+		}
+	}
+
+	for _, frameworkPath := range frameworkPaths {
+		frameworkExecutable := strings.TrimSuffix(path.Base(frameworkPath), ".framework")
+
+		if data, err := abc.readFile(path.Join(frameworkPath, infoPlistName)); err == nil {
+			if info, err := parsePlistDict(data); err == nil {
+				if value := plistString(info, "CFBundleExecutable"); len(value) > 0 {
+					frameworkExecutable = value
+				}
+			}
+		}
+
+		if binaryName := path.Join(frameworkPath, frameworkExecutable); abc.hasFile(binaryName) {
+			binaryNames = append(binaryNames, binaryName)
+		}
+	}
+
+	return binaryNames
+}
+
+func (abc *appBundleContents) hasFile(name string) bool {
+	return slices.Contains(abc.names, name)
+}
+
+func (abc *appBundleContents) inspect(buildPath string) (*appleBundleInfo, error) {
+	abi, err := abc.readBundleInfo(buildPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := abc.verifyBinaries(buildPath, abi); err != nil {
+		return nil, err
+	}
+
+	return abi, nil
+}
+
+func (abc *appBundleContents) openBinary(name string) (bundleFile, error) {
+	if abc.openFile != nil {
+		return abc.openFile(name)
+	}
+
+	data, err := abc.readFile(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &bufferedBundleFile{
+		Reader: bytes.NewReader(data)}, nil
+}
+
+func (abc *appBundleContents) readBundleInfo(buildPath string) (*appleBundleInfo, error) {
+	data, err := abc.readFile(infoPlistName)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %q in build at %q, error: %v", infoPlistName, buildPath, err)
+	}
+
+	abi, err := extractAppleBundleInfo(data, abc.hasFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %q in build at %q, error: %v", infoPlistName, buildPath, err)
+	}
+
+	return abi, nil
+}
+
+func (abc *appBundleContents) verifyBinaries(buildPath string, abi *appleBundleInfo) error {
+	var (
+		architectures []string
+		mismatches    []string
+	)
+
+	for _, binaryName := range abc.binaryNames(abi.executable) {
+		file, err := abc.openBinary(binaryName)
+
+		if err != nil {
+			return fmt.Errorf("Unable to read %q in build at %q, error: %v", binaryName, buildPath, err)
+		}
+
+		machoSlices, err := inspectMachO(file)
+
+		file.Close()
+
+		if err != nil {
+			return fmt.Errorf("Unable to inspect %q in build at %q, error: %v", binaryName, buildPath, err)
+		}
+
+		for _, slice := range machoSlices {
+			if binaryName == abi.executable {
+				architectures = appendIfMissing(architectures, slice.arch)
+			}
+
+			if !slice.isIOSSimulator() {
+				mismatches = append(mismatches, fmt.Sprintf("%s (%s)", binaryName, slice.string()))
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("Build at %q is not an iOS simulator build, found: %s. Rebuild your app with `xcodebuild -sdk iphonesimulator` (arm64 or x86_64) and make sure every embedded framework is built for the iOS simulator too", buildPath, strings.Join(mismatches, ", "))
+	}
+
+	abi.architectures = architectures
+
+	return nil
+}
+
+func (abi *appleBundleInfo) deviceFamily() string {
+	if abi == nil {
+		return ""
+	}
+
+	return strings.Join(abi.deviceFamilies, ",")
+}
+
+func (bbf *bufferedBundleFile) Close() error {
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Matches the files of an app bundle whose contents are needed to inspect it
+// when it can only be read sequentially. Since an executable may be named
+// anything, any file with an executable bit is a candidate, as well as any
+// file without an extension.
+func isAppBundleInspectable(name string, executable bool) bool {
+	isCandidate := func(fileName string) bool {
+		return executable || len(path.Ext(fileName)) == 0
+	}
+
+	if name == infoPlistName || (!strings.Contains(name, "/") && isCandidate(name)) {
+		return true
+	}
+
+	folder, rest, _ := strings.Cut(name, "/")
+
+	if folder != "Frameworks" {
+		return false
+	}
+
+	if !strings.Contains(rest, "/") {
+		return path.Ext(rest) == ".dylib"
+	}
+
+	frameworkName, fileName, _ := strings.Cut(rest, "/")
+
+	return path.Ext(frameworkName) == ".framework" && !strings.Contains(fileName, "/") &&
+		(fileName == infoPlistName || isCandidate(fileName))
+}
+
+func plistDeviceFamilies(info map[string]any) []string {
+	var values []any
+
+	switch value := info["UIDeviceFamily"].(type) {
+	case []any:
+		values = value
+
+	case nil:
+		return nil
+
+	default:
+		values = []any{value}
+	}
+
+	var families []string
+
+	for _, value := range values {
+		var family int64
+
+		switch v := value.(type) {
+		case int64:
+			family = v
+
+		case string:
+			family, _ = strconv.ParseInt(v, 10, 64)
+		}
+
+		if name, ok := appleDeviceFamilyNames[family]; ok {
+			families = append(families, name)
+		} else {
+			families = append(families, fmt.Sprintf("%v", value))
+		}
+	}
+
+	return families
+}
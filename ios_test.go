@@ -0,0 +1,97 @@
+package main
+
+import (
+	"debug/macho"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestAppBundleContents(files map[string][]byte) *appBundleContents {
+	abc := &appBundleContents{
+		readFile: func(name string) ([]byte, error) {
+			if data, ok := files[name]; ok {
+				return data, nil
+			}
+
+			return nil, fs.ErrNotExist
+		}}
+
+	for name := range files {
+		abc.names = append(abc.names, name)
+	}
+
+	slices.Sort(abc.names)
+
+	return abc
+}
+
+func TestAppBundleContentsInspect(t *testing.T) {
+	abc := newTestAppBundleContents(map[string][]byte{
+		"Info.plist":                    []byte(testAppInfoPlist),
+		"MyApp":                         makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOSSimulator),
+		"Frameworks/Foo.framework/Foo":  makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOSSimulator),
+		"Frameworks/libswiftCore.dylib": makeTestMachO(macho.CpuAmd64, machoLoadCmdVersionMinIOS, 0)})
+
+	abi, err := abc.inspect("MyApp.app")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(abi.architectures, []string{"arm64"}) {
+		t.Errorf("Expected [arm64], got %v", abi.architectures)
+	}
+}
+
+func TestAppBundleContentsInspectDeviceFramework(t *testing.T) {
+	abc := newTestAppBundleContents(map[string][]byte{
+		"Info.plist":                   []byte(testAppInfoPlist),
+		"MyApp":                        makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOSSimulator),
+		"Frameworks/Foo.framework/Foo": makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOS)})
+
+	_, err := abc.inspect("MyApp.app")
+
+	if err == nil || !strings.Contains(err.Error(), "Frameworks/Foo.framework/Foo (arm64: iOS)") {
+		t.Errorf("Expected error naming device framework, got %v", err)
+	}
+}
+
+func TestAppBundleContentsInspectNoPlatform(t *testing.T) {
+	abc := newTestAppBundleContents(map[string][]byte{
+		"Info.plist": []byte(testAppInfoPlist),
+		"MyApp":      makeTestMachO(macho.CpuArm64, uint32(macho.LoadCmdUnixThread), 0)})
+
+	_, err := abc.inspect("MyApp.app")
+
+	if err == nil || !strings.Contains(err.Error(), "MyApp (arm64: unknown platform)") {
+		t.Errorf("Expected error naming executable of unknown platform, got %v", err)
+	}
+}
+
+func TestIsAppBundleInspectable(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"Info.plist":                          true,
+		"MyApp":                               true,
+		"Assets.car":                          false,
+		"Base.lproj/Main.storyboardc":         false,
+		"Frameworks/Foo.framework/Foo":        true,
+		"Frameworks/Foo.framework/Info.plist": true,
+		"Frameworks/Foo.framework/Foo.bundle": false,
+		"Frameworks/libswiftCore.dylib":       true} {
+		if actual := isAppBundleInspectable(name, false); actual != expected {
+			t.Errorf("Expected %v for %q, got %v", expected, name, actual)
+		}
+	}
+
+	for name, expected := range map[string]bool{
+		"My.App":                                true,
+		"Base.lproj/Main.nib":                   false,
+		"Frameworks/Foo.framework/Foo.Core":     true,
+		"Frameworks/Foo.framework/Sub/Foo.Core": false} {
+		if actual := isAppBundleInspectable(name, true); actual != expected {
+			t.Errorf("Expected %v for executable %q, got %v", expected, name, actual)
+		}
+	}
+}
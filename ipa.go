@@ -0,0 +1,140 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const ipaPayloadFolder = "Payload"
+
+func findIPAApp(zr *zip.Reader) (string, error) {
+	var appNames []string
+
+	for _, file := range zr.File {
+		folder, rest, _ := strings.Cut(file.Name, "/")
+
+		if folder != ipaPayloadFolder {
+			continue
+		}
+
+		appName, _, _ := strings.Cut(rest, "/")
+
+		if strings.HasSuffix(appName, ".app") && !slices.Contains(appNames, appName) {
+			appNames = append(appNames, appName)
+		}
+	}
+
+	switch len(appNames) {
+	case 0:
+		return "", fmt.Errorf("no app found in %q", ipaPayloadFolder)
+
+	case 1:
+		return appNames[0], nil
+
+	default:
+		return "", fmt.Errorf("more than one app found in %q (%s)", ipaPayloadFolder, strings.Join(appNames, ", "))
+	}
+}
+
+func inspectIPA(ipaPath string) (*buildInfo, error) {
+	zr, err := zip.OpenReader(ipaPath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read build at %q, error: %v", ipaPath, err)
+	}
+
+	defer zr.Close()
+
+	appName, err := findIPAApp(&zr.Reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read build at %q, %v", ipaPath, err)
+	}
+
+	appPrefix := path.Join(ipaPayloadFolder, appName)
+	abc := newZipAppBundleContents(&zr.Reader, appPrefix)
+
+	abi, err := abc.readBundleInfo(ipaPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := abc.readFile(abi.executable)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read executable %q in build at %q, error: %v", abi.executable, ipaPath, err)
+	}
+
+	machoSlices, err := inspectMachO(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to inspect executable %q in build at %q, error: %v", abi.executable, ipaPath, err)
+	}
+
+	if !slices.ContainsFunc(machoSlices, machoSlice.isIOSSimulator) {
+		var platforms []string
+
+		for _, slice := range machoSlices {
+			for _, platform := range slice.platforms {
+				platforms = appendIfMissing(platforms, fmt.Sprintf("%s (%s)", platform, slice.arch))
+			}
+		}
+
+		if len(platforms) == 0 {
+			platforms = []string{"unknown"}
+		}
+
+		return nil, fmt.Errorf("Build at %q is a device build for %s, not an iOS simulator build. Rebuild your app with `xcodebuild -sdk iphonesimulator` and upload the resulting .app instead", ipaPath, strings.Join(platforms, ", "))
+	}
+
+	if err := abc.verifyBinaries(ipaPath, abi); err != nil {
+		return nil, err
+	}
+
+	return &buildInfo{
+		appName:         appName,
+		appleBundleInfo: abi}, nil
+}
+
+func repackageIPA(zipPath, ipaPath, appName string) error {
+	zr, err := zip.OpenReader(ipaPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer zr.Close()
+
+	zipFile, err := os.Create(zipPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer zipFile.Close()
+
+	zipWriter := zip.NewWriter(zipFile)
+	appPrefix := path.Join(ipaPayloadFolder, appName) + "/"
+
+	for _, file := range zr.File {
+		if !strings.HasPrefix(file.Name, appPrefix) || file.FileInfo().IsDir() {
+			continue
+		}
+
+		err := copyZipFile(zipWriter, file, strings.TrimPrefix(file.Name, ipaPayloadFolder+"/"))
+
+		if err != nil {
+			zipWriter.Close()
+
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/zip"
+	"debug/macho"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeTestIPA(t *testing.T, path string, executable []byte) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+
+	for name, content := range map[string][]byte{
+		"Payload/MyApp.app/MyApp":         executable,
+		"Payload/MyApp.app/Info.plist":    []byte(testAppInfoPlist),
+		"Payload/MyApp.app/Assets.car":    []byte("assets"),
+		"SwiftSupport/iphoneos/libfoo.so": []byte("swift")} {
+		writer, err := zw.Create(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := writer.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInspectIPADevice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "MyApp.ipa")
+
+	writeTestIPA(t, path, makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOS))
+
+	_, err := inspectIPA(path)
+
+	if err == nil || !strings.Contains(err.Error(), "iOS (arm64)") {
+		t.Errorf("Expected device build error naming iOS (arm64), got %v", err)
+	}
+}
+
+func TestInspectIPASimulator(t *testing.T) {
+	dir := t.TempDir()
+	ipaPath := filepath.Join(dir, "MyApp.ipa")
+	zipPath := filepath.Join(dir, "MyApp.zip")
+
+	writeTestIPA(t, ipaPath, makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOSSimulator))
+
+	bi, err := inspectIPA(ipaPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repackageIPA(zipPath, ipaPath, bi.appName); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer zr.Close()
+
+	var names []string
+
+	for _, file := range zr.File {
+		names = append(names, file.Name)
+	}
+
+	slices.Sort(names)
+
+	if !slices.Equal(names, []string{"MyApp.app/Assets.car", "MyApp.app/Info.plist", "MyApp.app/MyApp"}) {
+		t.Errorf("Expected app entries only, got %v", names)
+	}
+}
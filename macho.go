@@ -0,0 +1,174 @@
+package main
+
+import (
+	"debug/macho"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	machoLoadCmdBuildVersion      = 0x32
+	machoLoadCmdVersionMinIOS     = 0x25
+	machoLoadCmdVersionMinMacOS   = 0x24
+	machoLoadCmdVersionMinTVOS    = 0x2f
+	machoLoadCmdVersionMinWatchOS = 0x30
+
+	machoPlatformMacOS        = 1
+	machoPlatformIOS          = 2
+	machoPlatformTVOS         = 3
+	machoPlatformWatchOS      = 4
+	machoPlatformIOSSimulator = 7
+)
+
+type machoSlice struct {
+	arch      string
+	platforms []string
+}
+
+//-----------------------------------------------------------------------------
+
+var appleSimulatorArchitectures = []string{"arm64", "x86_64"}
+
+// Matches the `PLATFORM_*` constants of `<mach-o/loader.h>`.
+var machoPlatformNames = map[uint32]string{
+	1:  "macOS",
+	2:  "iOS",
+	3:  "tvOS",
+	4:  "watchOS",
+	5:  "bridgeOS",
+	6:  "Mac Catalyst",
+	7:  "iOS Simulator",
+	8:  "tvOS Simulator",
+	9:  "watchOS Simulator",
+	10: "DriverKit",
+	11: "visionOS",
+	12: "visionOS Simulator"}
+
+//-----------------------------------------------------------------------------
+
+func inspectMachO(r io.ReaderAt) ([]machoSlice, error) {
+	fat, err := macho.NewFatFile(r)
+
+	if err == nil {
+		defer fat.Close()
+
+		var machoSlices []machoSlice
+
+		for _, arch := range fat.Arches {
+			machoSlices = append(machoSlices, makeMachOSlice(arch.File))
+		}
+
+		return machoSlices, nil
+	}
+
+	if !errors.Is(err, macho.ErrNotFat) {
+		return nil, err
+	}
+
+	file, err := macho.NewFile(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return []machoSlice{makeMachOSlice(file)}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// Every platform the slice declares must be the iOS Simulator; a slice that
+// declares none might run anywhere, so it does not qualify.
+func (ms machoSlice) isIOSSimulator() bool {
+	if len(ms.platforms) == 0 || !slices.Contains(appleSimulatorArchitectures, ms.arch) {
+		return false
+	}
+
+	for _, platform := range ms.platforms {
+		if platform != machoPlatformNames[machoPlatformIOSSimulator] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ms machoSlice) string() string {
+	if len(ms.platforms) == 0 {
+		return ms.arch + ": unknown platform"
+	}
+
+	return ms.arch + ": " + strings.Join(ms.platforms, ", ")
+}
+
+//-----------------------------------------------------------------------------
+
+func machoArchName(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.Cpu386:
+		return "i386"
+
+	case macho.CpuAmd64:
+		return "x86_64"
+
+	case macho.CpuArm:
+		return "armv7"
+
+	case macho.CpuArm64:
+		return "arm64"
+
+	default:
+		return fmt.Sprintf("cpu%d", uint32(cpu))
+	}
+}
+
+func machoPlatformName(platform uint32) string {
+	if name, ok := machoPlatformNames[platform]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("platform %d", platform)
+}
+
+func makeMachOSlice(file *macho.File) machoSlice {
+	slice := machoSlice{arch: machoArchName(file.Cpu)}
+	isIntel := file.Cpu == macho.Cpu386 || file.Cpu == macho.CpuAmd64
+
+	for _, load := range file.Loads {
+		raw := load.Raw()
+
+		if len(raw) < 8 {
+			continue
+		}
+
+		switch file.ByteOrder.Uint32(raw) {
+		case machoLoadCmdBuildVersion:
+			if len(raw) >= 12 {
+				slice.platforms = append(slice.platforms, machoPlatformName(file.ByteOrder.Uint32(raw[8:])))
+			}
+
+		case machoLoadCmdVersionMinIOS:
+			// Pre-Xcode 12 simulator builds only have this on Intel slices
+			if isIntel {
+				slice.platforms = append(slice.platforms, machoPlatformName(machoPlatformIOSSimulator))
+			} else {
+				slice.platforms = append(slice.platforms, machoPlatformName(machoPlatformIOS))
+			}
+
+		case machoLoadCmdVersionMinMacOS:
+			slice.platforms = append(slice.platforms, machoPlatformName(machoPlatformMacOS))
+
+		case machoLoadCmdVersionMinTVOS:
+			slice.platforms = append(slice.platforms, machoPlatformName(machoPlatformTVOS))
+
+		case machoLoadCmdVersionMinWatchOS:
+			slice.platforms = append(slice.platforms, machoPlatformName(machoPlatformWatchOS))
+		}
+	}
+
+	return slice
+}
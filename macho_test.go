@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+func makeTestMachO(cpu macho.Cpu, cmd, platform uint32) []byte {
+	var buf bytes.Buffer
+
+	cmdSize := uint32(24)
+
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{
+		Magic: macho.Magic64,
+		Cpu:   cpu,
+		Type:  macho.TypeExec,
+		Ncmd:  1,
+		Cmdsz: cmdSize,
+		Flags: 0})
+
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // reserved
+
+	binary.Write(&buf, binary.LittleEndian, []uint32{cmd, cmdSize, platform, 0x000e0000, 0x000e0000, 0})
+
+	return buf.Bytes()
+}
+
+func TestInspectMachOBuildVersion(t *testing.T) {
+	machoSlices, err := inspectMachO(bytes.NewReader(makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOSSimulator)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(machoSlices) != 1 || machoSlices[0].arch != "arm64" || !machoSlices[0].isIOSSimulator() {
+		t.Errorf("Expected arm64 iOS Simulator slice, got %v", machoSlices)
+	}
+}
+
+func TestInspectMachODevice(t *testing.T) {
+	machoSlices, err := inspectMachO(bytes.NewReader(makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOS)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(machoSlices) != 1 || machoSlices[0].isIOSSimulator() || !slices.Equal(machoSlices[0].platforms, []string{"iOS"}) {
+		t.Errorf("Expected arm64 iOS slice, got %v", machoSlices)
+	}
+}
+
+func TestInspectMachONoPlatform(t *testing.T) {
+	machoSlices, err := inspectMachO(bytes.NewReader(makeTestMachO(macho.CpuArm64, uint32(macho.LoadCmdUnixThread), 0)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(machoSlices) != 1 || len(machoSlices[0].platforms) != 0 || machoSlices[0].isIOSSimulator() {
+		t.Errorf("Expected arm64 slice of unknown platform, got %v", machoSlices)
+	}
+}
+
+func TestInspectMachOVersionMinIntel(t *testing.T) {
+	machoSlices, err := inspectMachO(bytes.NewReader(makeTestMachO(macho.CpuAmd64, machoLoadCmdVersionMinIOS, 0)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(machoSlices) != 1 || !machoSlices[0].isIOSSimulator() {
+		t.Errorf("Expected x86_64 iOS Simulator slice, got %v", machoSlices)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	androidAttrDebuggable       = 0x0101000f
+	androidAttrMinSdkVersion    = 0x0101020c
+	androidAttrName             = 0x01010003
+	androidAttrTargetSdkVersion = 0x01010270
+	androidAttrVersionCode      = 0x0101021b
+	androidAttrVersionName      = 0x0101021c
+	androidManifestName         = "AndroidManifest.xml"
+)
+
+type androidManifest struct {
+	debuggable       bool
+	launcherActivity string
+	minSdkVersion    string
+	packageName      string
+	targetSdkVersion string
+	versionCode      string
+	versionName      string
+}
+
+//-----------------------------------------------------------------------------
+
+func extractAndroidManifest(root *axmlNode) (*androidManifest, error) {
+	if root == nil || root.name != "manifest" {
+		return nil, errors.New("root element is not <manifest>")
+	}
+
+	am := &androidManifest{}
+
+	am.packageName, _ = root.attribute("package", 0)
+	am.versionCode, _ = root.attribute("versionCode", androidAttrVersionCode)
+	am.versionName, _ = root.attribute("versionName", androidAttrVersionName)
+
+	for _, child := range root.children {
+		switch child.name {
+		case "application":
+			debuggable, _ := child.attribute("debuggable", androidAttrDebuggable)
+
+			am.debuggable = debuggable == "true"
+
+			for _, component := range child.children {
+				if len(am.launcherActivity) == 0 && isLauncherActivity(component) {
+					name, _ := component.attribute("name", androidAttrName)
+
+					am.launcherActivity = resolveAndroidClassName(am.packageName, name)
+				}
+			}
+
+		case "uses-sdk":
+			am.minSdkVersion, _ = child.attribute("minSdkVersion", androidAttrMinSdkVersion)
+			am.targetSdkVersion, _ = child.attribute("targetSdkVersion", androidAttrTargetSdkVersion)
+		}
+	}
+
+	if len(am.packageName) == 0 {
+		return nil, errors.New("no package name")
+	}
+
+	return am, nil
+}
+
+func readAndroidManifest(zr *zip.Reader) (*androidManifest, error) {
+	file := findZipFile(zr, androidManifestName)
+
+	if file == nil {
+		return nil, fmt.Errorf("no %q found", androidManifestName)
+	}
+
+	data, err := readZipFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parseAXML(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return extractAndroidManifest(root)
+}
+
+//-----------------------------------------------------------------------------
+
+func (am *androidManifest) debuggableString() string {
+	if am == nil {
+		return ""
+	}
+
+	if am.debuggable {
+		return "true"
+	}
+
+	return "false"
+}
+
+//-----------------------------------------------------------------------------
+
+func hasChildWithName(node *axmlNode, element, name string) bool {
+	for _, child := range node.children {
+		if child.name != element {
+			continue
+		}
+
+		if value, _ := child.attribute("name", androidAttrName); value == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isLauncherActivity(node *axmlNode) bool {
+	if node.name != "activity" && node.name != "activity-alias" {
+		return false
+	}
+
+	for _, child := range node.children {
+		if child.name == "intent-filter" &&
+			hasChildWithName(child, "action", "android.intent.action.MAIN") &&
+			hasChildWithName(child, "category", "android.intent.category.LAUNCHER") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func resolveAndroidClassName(packageName, name string) string {
+	switch {
+	case strings.HasPrefix(name, "."):
+		return packageName + name
+
+	case len(name) > 0 && !strings.Contains(name, "."):
+		return packageName + "." + name
+
+	default:
+		return name
+	}
+}
@@ -10,10 +10,14 @@ import (
 //-----------------------------------------------------------------------------
 
 type UploadMetadata struct {
-	AppID        string    `json:"appID"`
-	AppVersionID string    `json:"appVersionID"`
-	Host         string    `json:"host"`
-	UploadTime   time.Time `json:"uploadTime"`
+	AppID               string    `json:"appID"`
+	AppVersionID        string    `json:"appVersionID"`
+	ArchiveCreationDate string    `json:"archiveCreationDate,omitempty"`
+	ArchiveScheme       string    `json:"archiveScheme,omitempty"`
+	Host                string    `json:"host"`
+	Linked              bool      `json:"linked,omitempty"`
+	SHA256              string    `json:"sha256,omitempty"`
+	UploadTime          time.Time `json:"uploadTime"`
 }
 
 //-----------------------------------------------------------------------------
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultUploadWorkers = 4
+
+//-----------------------------------------------------------------------------
+
+func (ua *uploadAction) uploadBuildMultipart(retryAllowed bool) (bool, error) {
+	fmt.Printf("Uploading build to Waldo in parts with %d workers…\n", ua.uploadWorkers())
+
+	return ua.uploadBuildSession(retryAllowed, ua.uploadBuildPartsConcurrently)
+}
+
+// Each part is retried on its own, so that a transient failure only costs
+// that part a request. A part that exhausts its attempts fails the upload
+// without a retry of the whole session, which would give every part its
+// attempts again.
+func (ua *uploadAction) uploadBuildPartWithRetry(file *os.File, us *UploadSession, part UploadPart) error {
+	rp := ua.retryPolicy()
+
+	for attempts := 1; ; attempts++ {
+		retry, err := ua.uploadBuildPart(file, us, part, rp.isRetryAllowed(attempts))
+
+		if !retry || err == nil {
+			return err
+		}
+
+		emitError(err)
+
+		delay := rp.delay(attempts, ua.lastRetryAfter())
+
+		if !isBeforeDeadline(ua.deadline, delay) {
+			return err
+		}
+
+		fmt.Printf("\nFailed upload attempts for part %d: %d -- retrying in %v…\n\n", part.Number, attempts, delay.Round(time.Millisecond))
+
+		time.Sleep(delay)
+	}
+}
+
+// A part that fails for good stops the remaining parts from starting.
+func (ua *uploadAction) uploadBuildPartsConcurrently(file *os.File, us *UploadSession, parts []UploadPart, retryAllowed bool) (bool, error) {
+	var (
+		firstErr error
+		mutex    sync.Mutex
+		wg       sync.WaitGroup
+	)
+
+	queue := make(chan UploadPart)
+	done := make(chan struct{})
+
+	ua.client() // create the shared client before the workers race for it
+
+	for range min(ua.uploadWorkers(), len(parts)) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for part := range queue {
+				if err := ua.uploadBuildPartWithRetry(file, us, part); err != nil {
+					mutex.Lock()
+
+					if firstErr == nil {
+						firstErr = err
+
+						close(done)
+					}
+
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, part := range parts {
+		select {
+		case queue <- part:
+		case <-done:
+			break feed
+		}
+	}
+
+	close(queue)
+
+	wg.Wait()
+
+	return false, firstErr
+}
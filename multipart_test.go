@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestUploadBuildMultipart(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tus := &testUploadServer{
+		failPart: 4,
+		parts:    map[string]map[int][]byte{}}
+
+	server := httptest.NewServer(tus)
+
+	defer server.Close()
+
+	payloadPath, payload := writeTestPayload(t, 10*1024+100)
+
+	ua := newTestUploadAction(t, server.URL, payloadPath, "multipart")
+
+	ua.setUploadWorkers(3)
+
+	// The failed part is retried on its own, without failing the session
+	if err := ua.uploadBuildWithRetry(); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(tus.putParts)
+
+	if !slices.Equal(tus.putParts, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}) {
+		t.Errorf("Expected each part to be received once, got %v", tus.putParts)
+	}
+
+	if tus.openCount != 1 {
+		t.Errorf("Expected the upload session to be opened once, got %d", tus.openCount)
+	}
+
+	if !bytes.Equal(tus.uploadBytes, payload) {
+		t.Error("Uploaded bytes do not match payload")
+	}
+
+	if ua.failureTrace != nil {
+		t.Error("Expected the trace of the failed part to be cleared by the retry")
+	}
+}
+
+func TestUploadBuildMultipartFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tus := &testUploadServer{
+		failPart:   2,
+		failSticky: true,
+		parts:      map[string]map[int][]byte{}}
+
+	server := httptest.NewServer(tus)
+
+	defer server.Close()
+
+	payloadPath, _ := writeTestPayload(t, 4*1024)
+
+	ua := newTestUploadAction(t, server.URL, payloadPath, "multipart")
+
+	if err := ua.uploadBuildWithRetry(); err == nil {
+		t.Fatal("Expected upload to fail")
+	}
+
+	// The part gets the attempts of the retry policy, and the session is not
+	// retried on top of them.
+	if tus.failCount != 2 || tus.openCount != 1 {
+		t.Errorf("Expected 2 attempts at the part in 1 session, got %d in %d", tus.failCount, tus.openCount)
+	}
+}
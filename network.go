@@ -8,10 +8,42 @@ import (
 )
 
 const (
+	apkSetContentType = "application/x-apk-set"
 	binaryContentType = "application/octet-stream"
+	bundleContentType = "application/x-android-app-bundle"
 	jsonContentType   = "application/json"
 )
 
+// The settings shared by every request to Waldo, whichever the endpoint.
+type networkConfig struct {
+	proxyURL    *url.URL
+	timeouts    *networkTimeouts
+	tlsSettings *tlsSettings
+}
+
+//-----------------------------------------------------------------------------
+
+// A nil proxy URL selects the proxy from the environment, and nil timeouts
+// or TLS settings select the defaults. The TLS settings must be loaded.
+func newNetworkConfig(proxyURL *url.URL, nt *networkTimeouts, ts *tlsSettings) *networkConfig {
+	if nt == nil {
+		nt = newNetworkTimeouts(0, 0, 0, 0, 0)
+	}
+
+	if ts == nil {
+		ts = newTLSSettings(nil, "", "", nil)
+
+		ts.load() // cannot fail without any file or pin
+	}
+
+	return &networkConfig{
+		proxyURL:    proxyURL,
+		timeouts:    nt,
+		tlsSettings: ts}
+}
+
+//-----------------------------------------------------------------------------
+
 func addIfNotEmpty(query *url.Values, key string, value string) {
 	if len(key) > 0 && len(value) > 0 {
 		query.Add(key, value)
@@ -47,3 +79,30 @@ func shouldRetry(resp *http.Response) bool {
 		return false
 	}
 }
+
+//-----------------------------------------------------------------------------
+
+// Starts from the default transport, so that connection pooling and HTTP/2
+// keep their usual settings.
+func (nc *networkConfig) newClient(verbose bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	ps := newProxySelector(nc.proxyURL, verbose)
+
+	transport.ExpectContinueTimeout = 0
+	transport.Proxy = ps.choose
+	transport.TLSClientConfig = nc.tlsSettings.clientConfig(ps.tlsHosts())
+
+	nc.timeouts.apply(transport)
+
+	return &http.Client{
+		Transport: transport}
+}
+
+func (nc *networkConfig) proxyString() string {
+	if nc.proxyURL == nil {
+		return "(from environment)"
+	}
+
+	return nc.proxyURL.Redacted()
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	binaryPlistMagic    = "bplist00"
+	binaryPlistMaxDepth = 64
+)
+
+type binaryPlist struct {
+	data          []byte
+	objectRefSize int
+	offsets       []uint64
+}
+
+//-----------------------------------------------------------------------------
+
+var binaryPlistEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//-----------------------------------------------------------------------------
+
+func parseBinaryPlist(data []byte) (any, error) {
+	if len(data) < len(binaryPlistMagic)+32 {
+		return nil, errors.New("truncated binary plist")
+	}
+
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	objectRefSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	offsetTableOffset := binary.BigEndian.Uint64(trailer[24:])
+
+	// Compared against the remaining length, so that no sum or product of
+	// untrusted values can wrap around.
+	tableEnd := uint64(len(data) - 32)
+
+	if offsetSize < 1 || offsetSize > 8 || objectRefSize < 1 || objectRefSize > 8 ||
+		topObject >= numObjects || offsetTableOffset > tableEnd ||
+		numObjects > (tableEnd-offsetTableOffset)/uint64(offsetSize) {
+		return nil, errors.New("malformed binary plist trailer")
+	}
+
+	bp := &binaryPlist{
+		data:          data,
+		objectRefSize: objectRefSize,
+		offsets:       make([]uint64, numObjects)}
+
+	for idx := range bp.offsets {
+		start := offsetTableOffset + uint64(idx)*uint64(offsetSize)
+
+		bp.offsets[idx] = readBigEndianUint(data[start : start+uint64(offsetSize)])
+	}
+
+	return bp.decodeObject(topObject, 0)
+}
+
+//-----------------------------------------------------------------------------
+
+func (bp *binaryPlist) decodeCount(pos uint64, info byte) (uint64, uint64, error) {
+	if info != 0x0f {
+		return uint64(info), pos, nil
+	}
+
+	if pos >= uint64(len(bp.data)) || bp.data[pos]>>4 != 0x1 {
+		return 0, 0, errors.New("malformed binary plist count")
+	}
+
+	size := uint64(1) << (bp.data[pos] & 0x0f)
+
+	if !bp.hasBytes(pos+1, size) {
+		return 0, 0, errors.New("truncated binary plist count")
+	}
+
+	return readBigEndianUint(bp.data[pos+1 : pos+1+size]), pos + 1 + size, nil
+}
+
+func (bp *binaryPlist) decodeObject(ref uint64, depth int) (any, error) {
+	if ref >= uint64(len(bp.offsets)) || depth > binaryPlistMaxDepth {
+		return nil, errors.New("invalid binary plist object reference")
+	}
+
+	pos := bp.offsets[ref]
+
+	if pos >= uint64(len(bp.data)) {
+		return nil, errors.New("binary plist object offset out of range")
+	}
+
+	marker := bp.data[pos]
+	kind, info := marker>>4, marker&0x0f
+	pos++
+
+	switch kind {
+	case 0x0:
+		switch info {
+		case 0x8:
+			return false, nil
+
+		case 0x9:
+			return true, nil
+
+		default:
+			return nil, nil
+		}
+
+	case 0x1: // integer
+		size := uint64(1) << info
+
+		if !bp.hasBytes(pos, size) {
+			return nil, errors.New("truncated binary plist integer")
+		}
+
+		if size > 8 { // 128-bit integers keep their value in the low 8 bytes
+			pos += size - 8
+			size = 8
+		}
+
+		return int64(readBigEndianUint(bp.data[pos : pos+size])), nil
+
+	case 0x2, 0x3: // real, date
+		size := uint64(1) << info
+
+		if !bp.hasBytes(pos, size) || (size != 4 && size != 8) {
+			return nil, errors.New("malformed binary plist real")
+		}
+
+		value := float64(math.Float32frombits(uint32(readBigEndianUint(bp.data[pos : pos+size]))))
+
+		if size == 8 {
+			value = math.Float64frombits(readBigEndianUint(bp.data[pos : pos+size]))
+		}
+
+		if kind == 0x3 {
+			return binaryPlistEpoch.Add(time.Duration(value * float64(time.Second))), nil
+		}
+
+		return value, nil
+
+	case 0x4, 0x5, 0x6: // data, ASCII string, UTF-16 string
+		count, pos, err := bp.decodeCount(pos, info)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if count > uint64(len(bp.data)) {
+			return nil, errors.New("truncated binary plist data")
+		}
+
+		size := count
+
+		if kind == 0x6 {
+			size *= 2
+		}
+
+		if !bp.hasBytes(pos, size) {
+			return nil, errors.New("truncated binary plist data")
+		}
+
+		raw := bp.data[pos : pos+size]
+
+		switch kind {
+		case 0x4:
+			return append([]byte{}, raw...), nil
+
+		case 0x5:
+			return string(raw), nil
+
+		default:
+			units := make([]uint16, count)
+
+			for idx := range units {
+				units[idx] = binary.BigEndian.Uint16(raw[idx*2:])
+			}
+
+			return string(utf16.Decode(units)), nil
+		}
+
+	case 0x8: // UID
+		size := uint64(info) + 1
+
+		if !bp.hasBytes(pos, size) {
+			return nil, errors.New("truncated binary plist UID")
+		}
+
+		return readBigEndianUint(bp.data[pos : pos+size]), nil
+
+	case 0xa, 0xc: // array, set
+		count, pos, err := bp.decodeCount(pos, info)
+
+		if err != nil {
+			return nil, err
+		}
+
+		refs, err := bp.decodeRefs(pos, count)
+
+		if err != nil {
+			return nil, err
+		}
+
+		array := make([]any, len(refs))
+
+		for idx, ref := range refs {
+			if array[idx], err = bp.decodeObject(ref, depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		return array, nil
+
+	case 0xd: // dict
+		count, pos, err := bp.decodeCount(pos, info)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if count > uint64(len(bp.data)) {
+			return nil, errors.New("truncated binary plist dictionary")
+		}
+
+		refs, err := bp.decodeRefs(pos, count*2)
+
+		if err != nil {
+			return nil, err
+		}
+
+		dict := make(map[string]any, count)
+
+		for idx := uint64(0); idx < count; idx++ {
+			key, err := bp.decodeObject(refs[idx], depth+1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			keyString, ok := key.(string)
+
+			if !ok {
+				return nil, errors.New("binary plist dictionary key is not a string")
+			}
+
+			if dict[keyString], err = bp.decodeObject(refs[count+idx], depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		return dict, nil
+
+	default:
+		return nil, fmt.Errorf("unknown binary plist object type 0x%x", kind)
+	}
+}
+
+func (bp *binaryPlist) decodeRefs(pos, count uint64) ([]uint64, error) {
+	size := uint64(bp.objectRefSize)
+
+	if count > uint64(len(bp.data)) || !bp.hasBytes(pos, count*size) {
+		return nil, errors.New("truncated binary plist references")
+	}
+
+	refs := make([]uint64, count)
+
+	for idx := range refs {
+		start := pos + uint64(idx)*size
+
+		refs[idx] = readBigEndianUint(bp.data[start : start+size])
+	}
+
+	return refs, nil
+}
+
+// Reports whether size bytes follow pos, without overflowing.
+func (bp *binaryPlist) hasBytes(pos, size uint64) bool {
+	length := uint64(len(bp.data))
+
+	return pos <= length && size <= length-pos
+}
+
+//-----------------------------------------------------------------------------
+
+func decodeXMLPlistArray(decoder *xml.Decoder) ([]any, error) {
+	array := []any{}
+
+	for {
+		tok, err := decoder.Token()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			value, err := decodeXMLPlistValue(decoder, t)
+
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, value)
+
+		case xml.EndElement:
+			return array, nil
+		}
+	}
+}
+
+func decodeXMLPlistDict(decoder *xml.Decoder) (map[string]any, error) {
+	dict := map[string]any{}
+
+	for {
+		tok, err := decoder.Token()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "key" {
+				return nil, fmt.Errorf("expected <key>, found <%s>", t.Name.Local)
+			}
+
+			var key string
+
+			if err := decoder.DecodeElement(&key, &t); err != nil {
+				return nil, err
+			}
+
+			valueElement, err := nextXMLStartElement(decoder)
+
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeXMLPlistValue(decoder, valueElement)
+
+			if err != nil {
+				return nil, err
+			}
+
+			dict[key] = value
+
+		case xml.EndElement:
+			return dict, nil
+		}
+	}
+}
+
+func decodeXMLPlistValue(decoder *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "array":
+		return decodeXMLPlistArray(decoder)
+
+	case "dict":
+		return decodeXMLPlistDict(decoder)
+
+	case "false", "true":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+
+	case "date":
+		return time.Parse(time.RFC3339, strings.TrimSpace(text))
+
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+
+	case "string":
+		return text, nil
+
+	default:
+		return nil, fmt.Errorf("unknown plist element <%s>", start.Name.Local)
+	}
+}
+
+func nextXMLStartElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := decoder.Token()
+
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, nil
+
+		case xml.EndElement:
+			return xml.StartElement{}, fmt.Errorf("unexpected </%s>", t.Name.Local)
+		}
+	}
+}
+
+func parsePlist(data []byte) (any, error) {
+	if bytes.HasPrefix(data, []byte(binaryPlistMagic)) {
+		return parseBinaryPlist(data)
+	}
+
+	return parseXMLPlist(data)
+}
+
+func parsePlistDict(data []byte) (map[string]any, error) {
+	value, err := parsePlist(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dict, ok := value.(map[string]any)
+
+	if !ok {
+		return nil, fmt.Errorf("expected top-level dictionary, found %T", value)
+	}
+
+	return dict, nil
+}
+
+func parseXMLPlist(data []byte) (any, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		start, err := nextXMLStartElement(decoder)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if start.Name.Local != "plist" {
+			return decodeXMLPlistValue(decoder, start)
+		}
+	}
+}
+
+func plistDate(dict map[string]any, key string) time.Time {
+	value, _ := dict[key].(time.Time)
+
+	return value
+}
+
+func plistDict(dict map[string]any, key string) map[string]any {
+	value, _ := dict[key].(map[string]any)
+
+	return value
+}
+
+func plistString(dict map[string]any, key string) string {
+	value, _ := dict[key].(string)
+
+	return value
+}
+
+func readBigEndianUint(data []byte) uint64 {
+	value := uint64(0)
+
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+const testXMLPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>ApplicationProperties</key>
+	<dict>
+		<key>ApplicationPath</key>
+		<string>Applications/MyApp.app</string>
+		<key>Architectures</key>
+		<array>
+			<string>arm64</string>
+		</array>
+	</dict>
+	<key>ArchiveVersion</key>
+	<integer>2</integer>
+	<key>CreationDate</key>
+	<date>2024-05-22T14:03:11Z</date>
+	<key>Data</key>
+	<data>
+	AQID
+	</data>
+	<key>Name</key>
+	<string>MyApp</string>
+	<key>Ratio</key>
+	<real>1.5</real>
+	<key>SchemeName</key>
+	<string>MyApp-Release</string>
+	<key>Signed</key>
+	<false/>
+</dict>
+</plist>
+`
+
+const testAppInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleExecutable</key>
+	<string>MyApp</string>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.MyApp</string>
+	<key>CFBundleShortVersionString</key>
+	<string>1.2.3</string>
+	<key>CFBundleVersion</key>
+	<string>42</string>
+	<key>MinimumOSVersion</key>
+	<string>15.0</string>
+	<key>UIDeviceFamily</key>
+	<array>
+		<integer>1</integer>
+		<integer>2</integer>
+	</array>
+</dict>
+</plist>
+`
+
+// Encodes a flat binary plist dictionary of ASCII strings, small integers and
+// arrays of small integers.
+func makeTestBinaryPlist(keys []string, values []any) []byte {
+	var (
+		objects [][]byte
+		refs    []byte
+	)
+
+	addObject := func(object []byte) byte {
+		objects = append(objects, object)
+
+		return byte(len(objects) - 1)
+	}
+
+	encode := func(value any) []byte {
+		switch v := value.(type) {
+		case string:
+			if len(v) >= 0x0f {
+				return append([]byte{0x5f, 0x10, byte(len(v))}, v...)
+			}
+
+			return append([]byte{0x50 | byte(len(v))}, v...)
+
+		default:
+			return []byte{0x10, byte(v.(int))}
+		}
+	}
+
+	addObject(nil) // root placeholder
+
+	for _, key := range keys {
+		refs = append(refs, addObject(encode(key)))
+	}
+
+	for _, value := range values {
+		if array, ok := value.([]int); ok {
+			object := []byte{0xa0 | byte(len(array))}
+
+			for _, item := range array {
+				object = append(object, addObject(encode(item)))
+			}
+
+			refs = append(refs, addObject(object))
+		} else {
+			refs = append(refs, addObject(encode(value)))
+		}
+	}
+
+	objects[0] = append([]byte{0xd0 | byte(len(keys))}, refs...)
+
+	data := []byte(binaryPlistMagic)
+
+	var offsets []byte
+
+	for _, object := range objects {
+		offsets = binary.BigEndian.AppendUint16(offsets, uint16(len(data)))
+		data = append(data, object...)
+	}
+
+	offsetTableOffset := len(data)
+
+	data = append(data, offsets...)
+	data = append(data, 0, 0, 0, 0, 0, 0, 2, 1)
+	data = binary.BigEndian.AppendUint64(data, uint64(len(objects)))
+	data = binary.BigEndian.AppendUint64(data, 0)
+	data = binary.BigEndian.AppendUint64(data, uint64(offsetTableOffset))
+
+	return data
+}
+
+func TestExtractAppleBundleInfo(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte(testAppInfoPlist),
+		makeTestBinaryPlist(
+			[]string{"CFBundleExecutable", "CFBundleIdentifier", "CFBundleShortVersionString", "CFBundleVersion", "MinimumOSVersion", "UIDeviceFamily"},
+			[]any{"MyApp", "com.example.MyApp", "1.2.3", "42", "15.0", []int{1, 2}})} {
+		abi, err := extractAppleBundleInfo(data, func(name string) bool { return name == "MyApp" })
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if abi.identifier != "com.example.MyApp" || abi.shortVersion != "1.2.3" || abi.version != "42" || abi.minOSVersion != "15.0" {
+			t.Errorf("Unexpected bundle info %+v", abi)
+		}
+
+		if abi.deviceFamily() != "iPhone,iPad" {
+			t.Errorf("Expected \"iPhone,iPad\", got %q", abi.deviceFamily())
+		}
+	}
+}
+
+func TestExtractAppleBundleInfoMissingExecutable(t *testing.T) {
+	if _, err := extractAppleBundleInfo([]byte(testAppInfoPlist), func(name string) bool { return false }); err == nil {
+		t.Errorf("Expected error for missing executable")
+	}
+}
+
+func TestParseBinaryPlistMalformed(t *testing.T) {
+	makeTrailer := func(offsetSize byte, numObjects, offsetTableOffset uint64) []byte {
+		trailer := []byte{0, 0, 0, 0, 0, 0, offsetSize, 1}
+		trailer = binary.BigEndian.AppendUint64(trailer, numObjects)
+		trailer = binary.BigEndian.AppendUint64(trailer, 0)
+
+		return binary.BigEndian.AppendUint64(trailer, offsetTableOffset)
+	}
+
+	// An offset table that wraps past the end of the address space.
+	wrappingTable := append([]byte(binaryPlistMagic+"\x00\x00\x00\x00\x00\x00\x00\x00"), makeTrailer(8, 1, 1<<64-8)...)
+
+	// A UTF-16 string whose length in bytes wraps around.
+	hugeString := append([]byte(binaryPlistMagic), 0x6f, 0x13, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 8)
+	hugeString = append(hugeString, makeTrailer(1, 1, 18)...)
+
+	for name, data := range map[string][]byte{"wrapping table": wrappingTable, "huge string": hugeString} {
+		if _, err := parsePlist(data); err == nil {
+			t.Errorf("Expected error for binary plist with %s", name)
+		}
+	}
+}
+
+func TestParseBinaryPlistTruncated(t *testing.T) {
+	data := makeTestBinaryPlist([]string{"Key"}, []any{"Value"})
+
+	if _, err := parsePlist(data[:len(data)-8]); err == nil {
+		t.Errorf("Expected error for truncated binary plist")
+	}
+}
+
+func TestParseXMLPlist(t *testing.T) {
+	dict, err := parsePlistDict([]byte(testXMLPlist))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value := plistString(plistDict(dict, "ApplicationProperties"), "ApplicationPath"); value != "Applications/MyApp.app" {
+		t.Errorf("Expected \"Applications/MyApp.app\", got %q", value)
+	}
+
+	if value := dict["ArchiveVersion"]; value != int64(2) {
+		t.Errorf("Expected 2, got %v", value)
+	}
+
+	if value := plistDate(dict, "CreationDate"); !value.Equal(time.Date(2024, 5, 22, 14, 3, 11, 0, time.UTC)) {
+		t.Errorf("Expected 2024-05-22T14:03:11Z, got %v", value)
+	}
+
+	if value, _ := dict["Data"].([]byte); !bytes.Equal(value, []byte{1, 2, 3}) {
+		t.Errorf("Expected [1 2 3], got %v", value)
+	}
+
+	if value := dict["Ratio"]; value != 1.5 {
+		t.Errorf("Expected 1.5, got %v", value)
+	}
+
+	if value := dict["Signed"]; value != false {
+		t.Errorf("Expected false, got %v", value)
+	}
+}
+
+func TestParseXMLPlistNotDict(t *testing.T) {
+	if _, err := parsePlistDict([]byte(`<plist><array/></plist>`)); err == nil {
+		t.Errorf("Expected error for non-dictionary plist")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressBarWidth       = 30
+	progressLogInterval    = 30 * time.Second
+	progressRedrawInterval = 200 * time.Millisecond
+)
+
+//-----------------------------------------------------------------------------
+
+type progressReader struct {
+	reader   io.Reader
+	reporter *progressReporter
+}
+
+// Reports bytes sent across all the requests of an upload: a live bar on a
+// terminal, otherwise a line every 10% or every 30 seconds, whichever comes
+// first, so that CI does not mistake a long upload for a hung job.
+type progressReporter struct {
+	isTTY      bool
+	lastDecile int
+	lastReport time.Time
+	mutex      sync.Mutex
+	output     io.Writer
+	sent       int64
+	startTime  time.Time
+	stopTime   time.Time
+	total      int64
+}
+
+//-----------------------------------------------------------------------------
+
+// A negative total means that the size is not known in advance.
+func newProgressReporter(total int64) *progressReporter {
+	now := time.Now()
+
+	return &progressReporter{
+		isTTY:      isTerminal(os.Stdout),
+		lastReport: now,
+		output:     os.Stdout,
+		startTime:  now,
+		total:      total}
+}
+
+//-----------------------------------------------------------------------------
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.reader.Read(p)
+
+	pr.reporter.add(int64(n))
+
+	return n, err
+}
+
+//-----------------------------------------------------------------------------
+
+func (pr *progressReporter) add(n int64) {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	now := time.Now()
+
+	pr.sent += n
+
+	if pr.isTTY {
+		if now.Sub(pr.lastReport) >= progressRedrawInterval {
+			pr.lastReport = now
+
+			fmt.Fprintf(pr.output, "\r%s", pr.line(now))
+		}
+
+		return
+	}
+
+	if decile := pr.decile(); decile > pr.lastDecile || now.Sub(pr.lastReport) >= progressLogInterval {
+		pr.lastDecile = decile
+		pr.lastReport = now
+
+		fmt.Fprintf(pr.output, "%s\n", pr.line(now))
+	}
+}
+
+func (pr *progressReporter) decile() int {
+	if pr.total <= 0 {
+		return 0
+	}
+
+	return int(min(pr.sent, pr.total) * 10 / pr.total)
+}
+
+func (pr *progressReporter) finish() {
+	if pr == nil {
+		return
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if !pr.stopTime.IsZero() {
+		return
+	}
+
+	pr.stopTime = time.Now()
+
+	if pr.isTTY && pr.sent > 0 {
+		fmt.Fprintf(pr.output, "\r%s\n", pr.line(pr.stopTime))
+	}
+}
+
+func (pr *progressReporter) line(now time.Time) string {
+	rate := pr.rate(now)
+
+	if pr.total <= 0 {
+		return fmt.Sprintf("Uploaded %s at %s/s", formatBytes(pr.sent), formatBytes(int64(rate)))
+	}
+
+	sent := min(pr.sent, pr.total)
+	percent := sent * 100 / pr.total
+
+	eta := "unknown"
+
+	if rate > 0 {
+		eta = time.Duration(float64(pr.total-sent) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+
+	text := fmt.Sprintf("%3d%%  %s of %s at %s/s, ETA %s", percent, formatBytes(sent), formatBytes(pr.total), formatBytes(int64(rate)), eta)
+
+	if !pr.isTTY {
+		return "Uploaded " + text
+	}
+
+	filled := int(sent * progressBarWidth / pr.total)
+
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled) + "] " + text + "  " // clears a longer previous line
+}
+
+// In bytes per second.
+func (pr *progressReporter) rate(now time.Time) float64 {
+	elapsed := now.Sub(pr.startTime).Seconds()
+
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(pr.sent) / elapsed
+}
+
+func (pr *progressReporter) reader(reader io.Reader) io.Reader {
+	if pr == nil {
+		return reader
+	}
+
+	return &progressReader{
+		reader:   reader,
+		reporter: pr}
+}
+
+func (pr *progressReporter) stats() string {
+	if pr == nil {
+		return ""
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	stopTime := pr.stopTime
+
+	if stopTime.IsZero() {
+		stopTime = time.Now()
+	}
+
+	elapsed := stopTime.Sub(pr.startTime)
+
+	return fmt.Sprintf("Sent %s in %v (%s/s)", formatBytes(pr.sent), elapsed.Round(time.Millisecond), formatBytes(int64(pr.rate(stopTime))))
+}
+
+// Takes back bytes that the server did not keep, such as those of a failed
+// part, so that they do not inflate the rate and ETA.
+func (pr *progressReporter) subtract(n int64) {
+	if pr == nil {
+		return
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	pr.sent = max(pr.sent-n, 0)
+}
+
+//-----------------------------------------------------------------------------
+
+func formatBytes(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size) / unit
+
+	for _, prefix := range []string{"KiB", "MiB", "GiB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, prefix)
+		}
+
+		value /= unit
+	}
+
+	return fmt.Sprintf("%.1f TiB", value)
+}
+
+func isTerminal(file *os.File) bool {
+	fi, err := file.Stat()
+
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{
+		512:                    "512 B",
+		1536:                   "1.5 KiB",
+		5 * 1024 * 1024:        "5.0 MiB",
+		3 * 1024 * 1024 * 1024: "3.0 GiB"}
+
+	for size, expected := range cases {
+		if actual := formatBytes(size); actual != expected {
+			t.Errorf("Expected %q for %d, got %q", expected, size, actual)
+		}
+	}
+}
+
+func TestProgressReporterLogsEveryDecile(t *testing.T) {
+	var output bytes.Buffer
+
+	pr := newProgressReporter(1000)
+
+	pr.isTTY = false
+	pr.output = &output
+
+	if _, err := io.Copy(io.Discard, pr.reader(io.LimitReader(strings.NewReader(strings.Repeat("x", 1000)), 1000))); err != nil {
+		t.Fatal(err)
+	}
+
+	pr.finish()
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	if len(lines) == 0 || len(lines) > 10 || !strings.HasPrefix(lines[len(lines)-1], "Uploaded 100%") {
+		t.Errorf("Unexpected progress output: %q", output.String())
+	}
+
+	if stats := pr.stats(); !strings.HasPrefix(stats, "Sent 1000 B in ") {
+		t.Errorf("Unexpected stats: %q", stats)
+	}
+}
+
+func TestProgressReporterSmallReads(t *testing.T) {
+	var output bytes.Buffer
+
+	pr := newProgressReporter(1000)
+
+	pr.isTTY = false
+	pr.output = &output
+
+	for range 100 {
+		pr.add(10)
+	}
+
+	if lines := strings.Count(output.String(), "\n"); lines != 10 {
+		t.Errorf("Expected a line per decile, got %d: %q", lines, output.String())
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+type protoField struct {
+	data   []byte
+	number int
+	value  uint64
+}
+
+//-----------------------------------------------------------------------------
+
+func decodeProtoFields(data []byte) ([]protoField, error) {
+	var fields []protoField
+
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+
+		if n <= 0 {
+			return nil, errors.New("malformed protobuf field key")
+		}
+
+		data = data[n:]
+
+		field := protoField{number: int(key >> 3)}
+
+		switch key & 7 {
+		case 0: // varint
+			field.value, n = binary.Uvarint(data)
+
+			if n <= 0 {
+				return nil, errors.New("malformed protobuf varint")
+			}
+
+		case 1: // 64-bit
+			if n = 8; len(data) < n {
+				return nil, errors.New("truncated protobuf fixed64")
+			}
+
+			field.value = binary.LittleEndian.Uint64(data)
+
+		case 2: // length-delimited
+			size, m := binary.Uvarint(data)
+
+			if m <= 0 || uint64(len(data)-m) < size {
+				return nil, errors.New("truncated protobuf length-delimited field")
+			}
+
+			field.data = data[m : m+int(size)]
+
+			n = m + int(size)
+
+		case 5: // 32-bit
+			if n = 4; len(data) < n {
+				return nil, errors.New("truncated protobuf fixed32")
+			}
+
+			field.value = uint64(binary.LittleEndian.Uint32(data))
+
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+
+		data = data[n:]
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Chooses the proxy for each request: the one given with the `--proxy`
+// option, or else the one from the standard environment variables, unless
+// the host matches NO_PROXY.
+type proxySelector struct {
+	httpProxy  string
+	httpsProxy string
+	logged     map[string]bool
+	mutex      sync.Mutex
+	noProxy    string
+	verbose    bool
+}
+
+//-----------------------------------------------------------------------------
+
+func newProxySelector(proxyURL *url.URL, verbose bool) *proxySelector {
+	ps := &proxySelector{
+		httpProxy:  getenvAny("HTTP_PROXY", "http_proxy"),
+		httpsProxy: getenvAny("HTTPS_PROXY", "https_proxy"),
+		logged:     map[string]bool{},
+		noProxy:    getenvAny("NO_PROXY", "no_proxy"),
+		verbose:    verbose}
+
+	if proxyURL != nil {
+		ps.httpProxy = proxyURL.String()
+		ps.httpsProxy = proxyURL.String()
+	}
+
+	return ps
+}
+
+//-----------------------------------------------------------------------------
+
+func getenvAny(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); len(value) > 0 {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// Accepts a bare `host:port` as an HTTP proxy, as curl does. Credentials in
+// the URL are sent to the proxy with basic authentication.
+func parseProxyURL(value string) (*url.URL, error) {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+
+	proxyURL, err := url.Parse(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+
+	if len(proxyURL.Host) == 0 {
+		return nil, fmt.Errorf("missing proxy host")
+	}
+
+	return proxyURL, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (ps *proxySelector) choose(req *http.Request) (*url.URL, error) {
+	value := ps.httpsProxy
+
+	if req.URL.Scheme == "http" {
+		value = ps.httpProxy
+	}
+
+	if len(value) == 0 || ps.isExcluded(req.URL) {
+		ps.log(req.URL.Host, nil)
+
+		return nil, nil
+	}
+
+	proxyURL, err := parseProxyURL(value)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", value, err)
+	}
+
+	ps.log(req.URL.Host, proxyURL)
+
+	return proxyURL, nil
+}
+
+// Matches NO_PROXY entries the way curl does: `*` matches every host, an IP
+// address or CIDR range matches addresses, and a domain matches itself and its
+// subdomains, all optionally restricted to a port. Loopback hosts are never
+// proxied.
+func (ps *proxySelector) isExcluded(reqURL *url.URL) bool {
+	host := strings.ToLower(reqURL.Hostname())
+	port := reqURL.Port()
+
+	if len(port) == 0 {
+		port = map[string]string{"http": "80", "https": "443"}[reqURL.Scheme]
+	}
+
+	ip := net.ParseIP(host)
+
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return true
+	}
+
+	for _, entry := range strings.Split(strings.ToLower(ps.noProxy), ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "*" {
+			return true
+		}
+
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+
+			continue
+		}
+
+		if entryHost, entryPort, err := net.SplitHostPort(entry); err == nil {
+			if entryPort != port {
+				continue
+			}
+
+			entry = entryHost
+		}
+
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+
+		if len(entry) > 0 && (host == entry || strings.HasSuffix(host, "."+entry)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reports the choice once per host, without the proxy credentials.
+func (ps *proxySelector) log(host string, proxyURL *url.URL) {
+	if !ps.verbose {
+		return
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	if ps.logged[host] {
+		return
+	}
+
+	ps.logged[host] = true
+
+	if proxyURL != nil {
+		fmt.Printf("Using proxy %s for %s\n", proxyURL.Redacted(), host)
+	} else {
+		fmt.Printf("Using no proxy for %s\n", host)
+	}
+}
+
+// The hosts of the proxies that are themselves reached over TLS.
+func (ps *proxySelector) tlsHosts() []string {
+	var hosts []string
+
+	for _, value := range []string{ps.httpProxy, ps.httpsProxy} {
+		if proxyURL, err := parseProxyURL(value); err == nil && proxyURL.Scheme == "https" {
+			hosts = append(hosts, proxyURL.Hostname())
+		}
+	}
+
+	return hosts
+}
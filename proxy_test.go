@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseProxyURL(t *testing.T) {
+	if proxyURL, err := parseProxyURL("proxy.corp:3128"); err != nil || proxyURL.String() != "http://proxy.corp:3128" {
+		t.Errorf("Expected bare host to be an HTTP proxy, got %v, %v", proxyURL, err)
+	}
+
+	if _, err := parseProxyURL("ftp://proxy.corp"); err == nil {
+		t.Error("Expected unsupported scheme to be rejected")
+	}
+}
+
+func TestProxySelectorIsExcluded(t *testing.T) {
+	ps := &proxySelector{
+		noProxy: "internal.example, .corp.example, 10.0.0.0/8, uploads.example:8443"}
+
+	cases := map[string]bool{
+		"http://127.0.0.1:8080/":          true,
+		"http://localhost/":               true,
+		"https://10.1.2.3/":               true,
+		"https://api.corp.example/":       true,
+		"https://api.waldo.com/versions":  false,
+		"https://build.internal.example/": true,
+		"https://internal.example/":       true,
+		"https://notinternal.example/":    false,
+		"https://uploads.example/":        false,
+		"https://uploads.example:8443/":   true}
+
+	for rawURL, expected := range cases {
+		reqURL, _ := url.Parse(rawURL)
+
+		if actual := ps.isExcluded(reqURL); actual != expected {
+			t.Errorf("Expected %q to be excluded: %v, got %v", rawURL, expected, actual)
+		}
+	}
+
+	if !(&proxySelector{noProxy: "*"}).isExcluded(&url.URL{Scheme: "https", Host: "api.waldo.com"}) {
+		t.Error("Expected * to exclude every host")
+	}
+}
+
+func TestTriggerThroughAuthenticatedProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+	t.Setenv("no_proxy", "")
+
+	var proxyAuth, proxiedHost string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyAuth = r.Header.Get("Proxy-Authorization")
+		proxiedHost = r.URL.Host
+	}))
+
+	defer proxy.Close()
+
+	proxyURL, err := parseProxyURL("http://user:secret@" + proxy.Listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ta := newTriggerAction("token", "", "", false, map[string]string{
+		"apiTriggerEndpoint": "http://api.waldo.test/suites"})
+
+	ta.setNetwork(newNetworkConfig(proxyURL, nil, nil))
+	ta.setRetryPolicy(newRetryPolicy(1, 0, 0))
+
+	ta.validate()
+
+	if err := ta.perform(); err != nil {
+		t.Fatal(err)
+	}
+
+	if proxiedHost != "api.waldo.test" {
+		t.Errorf("Expected request for api.waldo.test through proxy, got %q", proxiedHost)
+	}
+
+	if expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret")); proxyAuth != expected {
+		t.Errorf("Expected proxy credentials %q, got %q", expected, proxyAuth)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The bucket holds at most this much of a second's worth of bytes, which
+// keeps the rate smooth without sleeping for every read.
+const rateLimiterBurst = 100 * time.Millisecond
+
+//-----------------------------------------------------------------------------
+
+type rateLimitedReader struct {
+	limiter *rateLimiter
+	reader  io.Reader
+}
+
+// A token bucket shared by every request of an upload, so that concurrent
+// parts and retries together stay within the limit.
+type rateLimiter struct {
+	burst    int64
+	lastFill time.Time
+	mutex    sync.Mutex
+	rate     int64
+	tokens   float64
+}
+
+//-----------------------------------------------------------------------------
+
+// A rate of zero or less means no limit.
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	burst := max(rate*int64(rateLimiterBurst)/int64(time.Second), 1024)
+
+	return &rateLimiter{
+		burst:    burst,
+		lastFill: time.Now(),
+		rate:     rate,
+		tokens:   float64(burst)}
+}
+
+//-----------------------------------------------------------------------------
+
+// Parses a rate in bytes per second, such as `500KB/s`, `20MB/s`, `2MiB/s` or
+// `100Mbit/s`. Decimal units are powers of 1000 and binary units powers of
+// 1024.
+func parseRate(value string) (int64, error) {
+	text := strings.TrimSuffix(strings.TrimSpace(value), "/s")
+
+	idx := strings.IndexFunc(text, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+
+	if idx < 0 {
+		idx = len(text)
+	}
+
+	number, err := strconv.ParseFloat(text[:idx], 64)
+
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", value)
+	}
+
+	units := map[string]float64{
+		"":     1,
+		"b":    1,
+		"gb":   1e9,
+		"gbit": 1e9 / 8,
+		"gib":  1 << 30,
+		"kb":   1e3,
+		"kbit": 1e3 / 8,
+		"kib":  1 << 10,
+		"mb":   1e6,
+		"mbit": 1e6 / 8,
+		"mib":  1 << 20}
+
+	unit, found := units[strings.ToLower(strings.TrimSpace(text[idx:]))]
+
+	if !found {
+		return 0, fmt.Errorf("unknown unit in rate %q", value)
+	}
+
+	rate := int64(number * unit)
+
+	if rate <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", value)
+	}
+
+	return rate, nil
+}
+
+//-----------------------------------------------------------------------------
+
+func (rlr *rateLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > rlr.limiter.burst {
+		p = p[:rlr.limiter.burst]
+	}
+
+	n, err := rlr.reader.Read(p)
+
+	rlr.limiter.wait(int64(n))
+
+	return n, err
+}
+
+//-----------------------------------------------------------------------------
+
+func (rl *rateLimiter) reader(reader io.Reader) io.Reader {
+	if rl == nil {
+		return reader
+	}
+
+	return &rateLimitedReader{
+		limiter: rl,
+		reader:  reader}
+}
+
+func (rl *rateLimiter) string() string {
+	if rl == nil {
+		return "unlimited"
+	}
+
+	return formatBytes(rl.rate) + "/s"
+}
+
+// Takes n tokens from the bucket, even if that puts it into debt, then sleeps
+// until the debt is repaid. Concurrent readers thus queue up behind each other.
+func (rl *rateLimiter) wait(n int64) {
+	if n <= 0 {
+		return
+	}
+
+	rl.mutex.Lock()
+
+	now := time.Now()
+
+	rl.tokens = min(rl.tokens+now.Sub(rl.lastFill).Seconds()*float64(rl.rate), float64(rl.burst))
+	rl.lastFill = now
+	rl.tokens -= float64(n)
+
+	deficit := -rl.tokens
+
+	rl.mutex.Unlock()
+
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / float64(rl.rate) * float64(time.Second)))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]int64{
+		"1048576":    1048576,
+		"20MB/s":     20000000,
+		"2MiB/s":     2 * 1024 * 1024,
+		"500 KB/s":   500000,
+		"1.5GB":      1500000000,
+		"100Mbit/s":  12500000,
+		"64kib/s":    64 * 1024,
+		"800 kbit/s": 100000}
+
+	for value, expected := range cases {
+		if actual, err := parseRate(value); err != nil || actual != expected {
+			t.Errorf("Expected %q to be %d bytes/s, got %d, %v", value, expected, actual, err)
+		}
+	}
+
+	for _, value := range []string{"", "fast", "0MB/s", "-5MB/s", "20XB/s"} {
+		if _, err := parseRate(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if rl := newRateLimiter(0); rl != nil || rl.string() != "unlimited" {
+		t.Errorf("Expected no limiter for a zero rate, got %v", rl)
+	}
+
+	rl := newRateLimiter(1000000)
+
+	payload := bytes.Repeat([]byte("x"), 300000)
+
+	start := time.Now()
+
+	var output bytes.Buffer
+
+	if _, err := io.Copy(&output, rl.reader(bytes.NewReader(payload))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first 100ms worth of bytes are a burst, the rest are paced.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected 300 KB at 1 MB/s to take about 200ms, took %v", elapsed)
+	}
+
+	if !bytes.Equal(output.Bytes(), payload) {
+		t.Error("Expected rate-limited payload to be unchanged")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay   = 1 * time.Second
+	defaultRetryMaxAttempts = 2
+	defaultRetryMaxDelay    = 30 * time.Second
+
+	// Bounds how long a server can hold up a CI job through Retry-After.
+	maxRetryAfterDelay = 5 * time.Minute
+)
+
+//-----------------------------------------------------------------------------
+
+type retryPolicy struct {
+	baseDelay   time.Duration
+	maxAttempts int
+	maxDelay    time.Duration
+}
+
+//-----------------------------------------------------------------------------
+
+// Zero values select the defaults.
+func newRetryPolicy(maxAttempts int, baseDelay, maxDelay time.Duration) *retryPolicy {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+
+	if baseDelay <= 0 {
+		baseDelay = defaultRetryBaseDelay
+	}
+
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+
+	return &retryPolicy{
+		baseDelay:   baseDelay,
+		maxAttempts: maxAttempts,
+		maxDelay:    max(baseDelay, maxDelay)}
+}
+
+//-----------------------------------------------------------------------------
+
+// A retry that cannot start before the overall deadline is pointless.
+func isBeforeDeadline(deadline time.Time, delay time.Duration) bool {
+	return deadline.IsZero() || time.Now().Add(delay).Before(deadline)
+}
+
+// Accepts both forms of the header: a number of seconds or an HTTP date.
+func parseRetryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(0, time.Duration(seconds)*time.Second)
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(0, time.Until(date))
+	}
+
+	return 0
+}
+
+// A request that never reached the server can always be sent again. Any other
+// transport failure leaves it unknown whether the server acted on the request,
+// so only idempotent requests are retried. An untrusted server stays untrusted,
+// so a failed verification is never retried.
+func shouldRetryError(err error, idempotent bool) bool {
+	var tve *tlsVerifyError
+
+	switch {
+	case errors.Is(err, errDeadlineExceeded), errors.As(err, &tve):
+		return false
+
+	case idempotent, errors.Is(err, errConnectTimeout), errors.Is(err, errTLSHandshakeTimeout):
+		return true
+	}
+
+	var dnsErr *net.DNSError
+
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// Unlike the other retryable statuses, these promise that the server did not
+// act on the request, so even non-idempotent requests can be sent again.
+func shouldRetryNonIdempotent(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case 408, 429, 503:
+		return true
+
+	default:
+		return false
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Full jitter: a random delay between zero and the exponential backoff for
+// this attempt, unless the server asked for a specific delay.
+func (rp *retryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, maxRetryAfterDelay)
+	}
+
+	backoff := rp.maxDelay
+
+	if shift := attempt - 1; shift < 32 && rp.baseDelay<<shift < rp.maxDelay {
+		backoff = rp.baseDelay << shift
+	}
+
+	return rand.N(backoff + 1)
+}
+
+func (rp *retryPolicy) isRetryAllowed(attempt int) bool {
+	return attempt < rp.maxAttempts
+}
+
+func (rp *retryPolicy) string() string {
+	return fmt.Sprintf("%d attempts, %v to %v backoff", rp.maxAttempts, rp.baseDelay, rp.maxDelay)
+}
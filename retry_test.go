@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+
+	if delay := parseRetryAfter(resp); delay != 0 {
+		t.Errorf("Expected no delay, got %v", delay)
+	}
+
+	resp.Header.Set("Retry-After", "7")
+
+	if delay := parseRetryAfter(resp); delay != 7*time.Second {
+		t.Errorf("Expected 7s, got %v", delay)
+	}
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+
+	if delay := parseRetryAfter(resp); delay < 58*time.Second || delay > time.Minute {
+		t.Errorf("Expected about 1m, got %v", delay)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	rp := newRetryPolicy(5, 100*time.Millisecond, time.Second)
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		limit := min(time.Second, 100*time.Millisecond<<(attempt-1))
+
+		for range 100 {
+			if delay := rp.delay(attempt, 0); delay < 0 || delay > limit {
+				t.Fatalf("Delay %v for attempt %d exceeds %v", delay, attempt, limit)
+			}
+		}
+	}
+
+	if delay := rp.delay(1, 3*time.Second); delay != 3*time.Second {
+		t.Errorf("Expected Retry-After to be honored, got %v", delay)
+	}
+
+	if delay := rp.delay(1, time.Hour); delay != maxRetryAfterDelay {
+		t.Errorf("Expected Retry-After to be capped, got %v", delay)
+	}
+}
+
+func TestShouldRetryError(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+
+	if !shouldRetryError(dialErr, false) || !shouldRetryError(readErr, true) {
+		t.Error("Expected unsent and idempotent requests to be retried")
+	}
+
+	if shouldRetryError(readErr, false) {
+		t.Error("Expected non-idempotent request not to be retried after it was sent")
+	}
+}
+
+func TestTriggerRunWithRetry(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK}
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(statuses[requests])
+
+		requests++
+	}))
+
+	defer server.Close()
+
+	ta := newTriggerAction("token", "", "", false, map[string]string{
+		"apiTriggerEndpoint": server.URL})
+
+	ta.setRetryPolicy(newRetryPolicy(3, time.Millisecond, time.Millisecond))
+
+	ta.validate()
+
+	// The 503 is retried, but the 500 may have triggered a run already.
+	if err := ta.triggerRunWithRetry(); err == nil {
+		t.Error("Expected trigger to fail")
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+func TestUploadErrorDeadline(t *testing.T) {
+	stalled := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stalled" {
+			<-stalled
+
+			return
+		}
+
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	defer server.Close()
+	defer close(stalled)
+
+	ua := newTestUploadAction(t, server.URL, "/some/path", "single")
+
+	ua.userOverrides["apiErrorEndpoint"] = server.URL + "/stalled"
+
+	start := time.Now()
+
+	if _, err := ua.uploadError(errors.New("Unable to upload build to Waldo"), start.Add(50*time.Millisecond), true); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("Expected stalled error report to exceed its deadline, got %v", err)
+	}
+
+	// A retry that cannot start within the budget is not waited for.
+	ua.userOverrides["apiErrorEndpoint"] = server.URL
+	ua.setRetryPolicy(newRetryPolicy(3, time.Millisecond, time.Millisecond))
+
+	if err := ua.uploadErrorWithRetry(errors.New("Unable to upload build to Waldo")); err == nil {
+		t.Error("Expected error report to fail")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected error report to give up quickly, took %v", elapsed)
+	}
+}
+
+func TestUploadErrorWithRetry(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(statuses[requests])
+
+		requests++
+	}))
+
+	defer server.Close()
+
+	ua := newTestUploadAction(t, server.URL, "/some/path", "single")
+
+	ua.userOverrides["apiErrorEndpoint"] = server.URL
+	ua.setRetryPolicy(newRetryPolicy(3, time.Millisecond, time.Millisecond))
+
+	// The 503 is retried, but the 502 may have recorded the error already.
+	if err := ua.uploadErrorWithRetry(errors.New("Unable to upload build to Waldo")); err == nil {
+		t.Error("Expected error report to fail")
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
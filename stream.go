@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+)
+
+// Compresses the app straight into the request body. Servers that insist on a
+// content length, and every retry, get the temporary zip file instead.
+func (ua *uploadAction) uploadBuildStream(retryAllowed bool) (bool, error) {
+	if !ua.isStreamingPayload() || ua.retryCount > 0 {
+		return ua.uploadBuildFallback(retryAllowed)
+	}
+
+	fmt.Printf("Streaming build to Waldo…\n")
+
+	appPath := ua.buildInfo.appPath
+	reader, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(writeFolderZip(writer, filepath.Dir(appPath), filepath.Base(appPath), ua.userCompressionLevel))
+	}()
+
+	defer reader.Close() // unblocks the compressor if the request ends early
+
+	ua.startProgress(-1)
+
+	retry, err := ua.sendBuild(ua.makeBuildURL(), ua.bodyReader(reader), -1, retryAllowed)
+
+	ua.progress.finish()
+
+	if err != nil && ua.failureStatusCode == http.StatusLengthRequired {
+		fmt.Printf("\nServer requires a content length -- falling back to a temporary file…\n\n")
+
+		return ua.uploadBuildFallback(retryAllowed)
+	}
+
+	return retry, err
+}
+
+func (ua *uploadAction) uploadBuildFallback(retryAllowed bool) (bool, error) {
+	if err := ua.ensureBuildPayload(); err != nil {
+		return false, err
+	}
+
+	return ua.uploadBuild(retryAllowed)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testStreamUpload(t *testing.T, requireLength bool) (*uploadAction, []int64) {
+	t.Setenv("HOME", t.TempDir())
+
+	var lengths []int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lengths = append(lengths, r.ContentLength)
+
+		if requireLength && r.ContentLength < 0 {
+			w.WriteHeader(http.StatusLengthRequired)
+
+			return
+		}
+
+		data, _ := io.ReadAll(r.Body)
+
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+
+		if err != nil || findZipFile(zr, "Example.app/Example") == nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		w.Write([]byte(`{"applicationId":"app-1","id":"appv-1"}`))
+	}))
+
+	defer server.Close()
+
+	appPath := filepath.Join(t.TempDir(), "Example.app")
+
+	if err := os.MkdirAll(appPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(appPath, "Example"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	workingPath := t.TempDir()
+
+	ua := newTestUploadAction(t, server.URL, filepath.Join(workingPath, "Example.app.zip"), "stream")
+
+	ua.absBuildPath = appPath
+	ua.buildInfo = &buildInfo{
+		appPath: appPath}
+	ua.buildSuffix = "app"
+
+	if _, err := ua.uploadBuildStream(false); err != nil {
+		t.Fatal(err)
+	}
+
+	return ua, lengths
+}
+
+//-----------------------------------------------------------------------------
+
+func TestUploadBuildStream(t *testing.T) {
+	ua, lengths := testStreamUpload(t, false)
+
+	if len(lengths) != 1 || lengths[0] != -1 {
+		t.Errorf("Expected a single chunked request, got lengths %v", lengths)
+	}
+
+	if isRegular(ua.absBuildPayloadPath) {
+		t.Error("Streaming should not write a temporary payload")
+	}
+}
+
+func TestUploadBuildStreamLengthRequired(t *testing.T) {
+	ua, lengths := testStreamUpload(t, true)
+
+	if len(lengths) != 2 || lengths[0] != -1 || lengths[1] <= 0 {
+		t.Errorf("Expected a chunked request then a sized one, got lengths %v", lengths)
+	}
+
+	if !isRegular(ua.absBuildPayloadPath) {
+		t.Error("Fallback should write a temporary payload")
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Only establishing a connection is bounded by default; a large build can
+// legitimately take a long time to send and to be processed.
+const (
+	defaultConnectTimeout      = 30 * time.Second
+	defaultTLSHandshakeTimeout = 30 * time.Second
+)
+
+//-----------------------------------------------------------------------------
+
+type cancelingBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+// The timer only starts with the first read, so that connecting and the TLS
+// handshake are bounded by their own timeouts rather than by this one.
+type idleReader struct {
+	body    io.ReadCloser
+	mutex   sync.Mutex
+	onIdle  func()
+	stopped bool
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// A zero duration disables the corresponding timeout.
+type networkTimeouts struct {
+	connect        time.Duration
+	deadline       time.Duration
+	idle           time.Duration
+	responseHeader time.Duration
+	tlsHandshake   time.Duration
+}
+
+//-----------------------------------------------------------------------------
+
+var (
+	errConnectTimeout        = errors.New("connect timeout")
+	errDeadlineExceeded      = errors.New("deadline exceeded")
+	errIdleTimeout           = errors.New("idle timeout, no bytes sent")
+	errResponseHeaderTimeout = errors.New("response header timeout")
+	errTLSHandshakeTimeout   = errors.New("TLS handshake timeout")
+)
+
+//-----------------------------------------------------------------------------
+
+// Zero values select the defaults for the connect and TLS handshake timeouts,
+// and leave the others disabled.
+func newNetworkTimeouts(connect, tlsHandshake, responseHeader, idle, deadline time.Duration) *networkTimeouts {
+	if connect <= 0 {
+		connect = defaultConnectTimeout
+	}
+
+	if tlsHandshake <= 0 {
+		tlsHandshake = defaultTLSHandshakeTimeout
+	}
+
+	return &networkTimeouts{
+		connect:        connect,
+		deadline:       deadline,
+		idle:           idle,
+		responseHeader: responseHeader,
+		tlsHandshake:   tlsHandshake}
+}
+
+//-----------------------------------------------------------------------------
+
+func (cb *cancelingBody) Close() error {
+	err := cb.ReadCloser.Close()
+
+	cb.cancel()
+
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+func (ir *idleReader) Close() error {
+	ir.stop()
+
+	return ir.body.Close()
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	ir.start()
+
+	n, err := ir.body.Read(p)
+
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	if ir.timer == nil {
+		return n, err
+	}
+
+	if err != nil {
+		ir.timer.Stop() // the body is sent, waiting for the response is not idling
+	} else if n > 0 {
+		ir.timer.Reset(ir.timeout)
+	}
+
+	return n, err
+}
+
+func (ir *idleReader) start() {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	if ir.timer == nil && !ir.stopped {
+		ir.timer = time.AfterFunc(ir.timeout, ir.onIdle)
+	}
+}
+
+func (ir *idleReader) stop() {
+	ir.mutex.Lock()
+	defer ir.mutex.Unlock()
+
+	ir.stopped = true
+
+	if ir.timer != nil {
+		ir.timer.Stop()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func (nt *networkTimeouts) apply(transport *http.Transport) {
+	dialer := &net.Dialer{
+		KeepAlive: 30 * time.Second,
+		Timeout:   nt.connect}
+
+	transport.DialContext = dialer.DialContext
+	transport.ResponseHeaderTimeout = nt.responseHeader
+	transport.TLSHandshakeTimeout = nt.tlsHandshake
+}
+
+// Gives each timeout an error of its own, so that it can be told apart in
+// the output and by the retry policy.
+func (nt *networkTimeouts) describeError(err, cause error) error {
+	var opErr *net.OpError
+
+	switch {
+	case errors.Is(cause, errDeadlineExceeded):
+		return fmt.Errorf("%w, not done within %v", errDeadlineExceeded, nt.deadline)
+
+	case errors.Is(cause, errIdleTimeout):
+		return fmt.Errorf("%w for %v", errIdleTimeout, nt.idle)
+
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return fmt.Errorf("%w, not connected within %v", errConnectTimeout, nt.connect)
+
+	case strings.Contains(err.Error(), "TLS handshake timeout"):
+		return fmt.Errorf("%w, not secured within %v", errTLSHandshakeTimeout, nt.tlsHandshake)
+
+	case strings.Contains(err.Error(), "timeout awaiting response headers"):
+		return fmt.Errorf("%w, no response within %v", errResponseHeaderTimeout, nt.responseHeader)
+
+	default:
+		return describeTLSError(err)
+	}
+}
+
+func (nt *networkTimeouts) makeDeadline(start time.Time) time.Time {
+	if nt.deadline <= 0 {
+		return time.Time{}
+	}
+
+	return start.Add(nt.deadline)
+}
+
+// Sends the request within the overall deadline, if any, and aborts it when
+// its body stops being read for longer than the idle timeout.
+func (nt *networkTimeouts) send(client *http.Client, req *http.Request, deadline time.Time) (*http.Response, error) {
+	ctx, cancelCause := context.WithCancelCause(req.Context())
+
+	cancel := func() { cancelCause(nil) }
+
+	if !deadline.IsZero() {
+		var cancelDeadline context.CancelFunc
+
+		ctx, cancelDeadline = context.WithDeadlineCause(ctx, deadline, errDeadlineExceeded)
+
+		cancel = func() {
+			cancelDeadline()
+			cancelCause(nil)
+		}
+	}
+
+	req = req.WithContext(ctx)
+
+	if nt.idle > 0 && req.Body != nil && req.Body != http.NoBody {
+		body := req.Body
+
+		// Closing the body also unblocks a reader that is stalled itself,
+		// such as the compressor of a streamed build.
+		ir := &idleReader{
+			body: body,
+			onIdle: func() {
+				cancelCause(errIdleTimeout)
+				body.Close()
+			},
+			timeout: nt.idle}
+
+		stop := cancel
+
+		cancel = func() {
+			ir.stop()
+			stop()
+		}
+
+		req.Body = ir
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		cause := context.Cause(ctx)
+
+		cancel()
+
+		return nil, nt.describeError(err, cause)
+	}
+
+	resp.Body = &cancelingBody{
+		ReadCloser: resp.Body,
+		cancel:     cancel}
+
+	return resp, nil
+}
+
+func (nt *networkTimeouts) string() string {
+	describe := func(timeout time.Duration) string {
+		if timeout <= 0 {
+			return "none"
+		}
+
+		return timeout.String()
+	}
+
+	return fmt.Sprintf("connect %s, TLS %s, response %s, idle %s, deadline %s",
+		describe(nt.connect),
+		describe(nt.tlsHandshake),
+		describe(nt.responseHeader),
+		describe(nt.idle),
+		describe(nt.deadline))
+}
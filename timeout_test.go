@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Holds up each incoming connection, as a busy server or proxy would.
+type slowListener struct {
+	net.Listener
+	delay time.Duration
+}
+
+func (sl *slowListener) Accept() (net.Conn, error) {
+	time.Sleep(sl.delay)
+
+	return sl.Listener.Accept()
+}
+
+// Sends a single byte, then stalls until the transport gives up on it.
+type stallingBody struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+	sent      bool
+}
+
+func (sb *stallingBody) Close() error {
+	sb.closeOnce.Do(func() { close(sb.closed) })
+
+	return nil
+}
+
+func (sb *stallingBody) Read(p []byte) (int, error) {
+	if !sb.sent {
+		sb.sent = true
+		p[0] = 'x'
+
+		return 1, nil
+	}
+
+	<-sb.closed
+
+	return 0, io.ErrClosedPipe
+}
+
+func sendTestRequest(t *testing.T, nt *networkTimeouts, deadline time.Time, body io.ReadCloser, delay time.Duration) error {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+
+		time.Sleep(delay)
+	}))
+
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", server.URL, body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := nt.send(newNetworkConfig(nil, nt, nil).newClient(false), req, deadline)
+
+	if err == nil {
+		resp.Body.Close()
+	}
+
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+func TestNetworkTimeouts(t *testing.T) {
+	payloadBody := func() io.ReadCloser { return io.NopCloser(strings.NewReader("payload")) }
+
+	err := sendTestRequest(t, newNetworkTimeouts(0, 0, 0, 50*time.Millisecond, 0), time.Time{}, &stallingBody{closed: make(chan struct{})}, 0)
+
+	if !errors.Is(err, errIdleTimeout) {
+		t.Errorf("Expected idle timeout, got %v", err)
+	}
+
+	err = sendTestRequest(t, newNetworkTimeouts(0, 0, 50*time.Millisecond, 0, 0), time.Time{}, payloadBody(), 200*time.Millisecond)
+
+	if !errors.Is(err, errResponseHeaderTimeout) {
+		t.Errorf("Expected response header timeout, got %v", err)
+	}
+
+	err = sendTestRequest(t, newNetworkTimeouts(0, 0, 0, 0, 50*time.Millisecond), time.Now().Add(50*time.Millisecond), payloadBody(), 200*time.Millisecond)
+
+	if !errors.Is(err, errDeadlineExceeded) {
+		t.Errorf("Expected deadline to be exceeded, got %v", err)
+	}
+
+	if shouldRetryError(err, true) {
+		t.Error("Expected an exceeded deadline not to be retried")
+	}
+
+	// An idle timeout does not apply while waiting for the response.
+	err = sendTestRequest(t, newNetworkTimeouts(0, 0, 0, 50*time.Millisecond, 0), time.Time{}, payloadBody(), 200*time.Millisecond)
+
+	if err != nil {
+		t.Errorf("Expected request to succeed, got %v", err)
+	}
+}
+
+func TestNetworkTimeoutsSlowAccept(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	server.Listener = &slowListener{
+		Listener: server.Listener,
+		delay:    200 * time.Millisecond}
+
+	server.StartTLS()
+
+	defer server.Close()
+
+	ts := newTLSSettings([]string{writeTestPEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)}, "", "", nil)
+
+	if err := ts.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	nt := newNetworkTimeouts(0, 0, 0, 50*time.Millisecond, 0)
+
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The TLS handshake waits for the server to accept, but no body is read
+	// yet, so this is not idling.
+	resp, err := nt.send(newNetworkConfig(nil, nt, ts).newClient(false), req, time.Time{})
+
+	if err != nil {
+		t.Fatalf("Expected request to succeed, got %v", err)
+	}
+
+	resp.Body.Close()
+}
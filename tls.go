@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const spkiPinPrefix = "sha256/"
+
+//-----------------------------------------------------------------------------
+
+type tlsSettings struct {
+	caFiles  []string
+	certFile string
+	config   *tls.Config
+	keyFile  string
+	pins     []string
+}
+
+type tlsVerifyError struct {
+	chain []*x509.Certificate
+	err   error
+	hint  string
+}
+
+//-----------------------------------------------------------------------------
+
+func newTLSSettings(caFiles []string, certFile, keyFile string, pins []string) *tlsSettings {
+	return &tlsSettings{
+		caFiles:  caFiles,
+		certFile: certFile,
+		keyFile:  keyFile,
+		pins:     pins}
+}
+
+func newTLSVerifyError(chain []*x509.Certificate, err error) *tlsVerifyError {
+	tve := &tlsVerifyError{
+		chain: chain,
+		err:   err}
+
+	var uaErr x509.UnknownAuthorityError
+
+	if errors.As(err, &uaErr) {
+		tve.hint = "add the root CA that issued it with --ca_file"
+	}
+
+	return tve
+}
+
+//-----------------------------------------------------------------------------
+
+func describeCertificate(cert *x509.Certificate) string {
+	return fmt.Sprintf("%q issued by %q, %s", cert.Subject.String(), cert.Issuer.String(), spkiPin(cert))
+}
+
+// Reports the chain that the server presented when the standard library
+// rejected it, and explains why the server rejected the handshake, which most
+// likely happens because of a missing or unacceptable client certificate.
+func describeTLSError(err error) error {
+	var cvErr *tls.CertificateVerificationError
+
+	if errors.As(err, &cvErr) {
+		return newTLSVerifyError(cvErr.UnverifiedCertificates, cvErr.Err)
+	}
+
+	if strings.Contains(err.Error(), "remote error: tls:") {
+		return fmt.Errorf("%w (the server rejected the TLS connection, check --client_cert and --client_key)", err)
+	}
+
+	return err
+}
+
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	return spkiPinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+//-----------------------------------------------------------------------------
+
+// Proxies reached over TLS present their own certificate, which is verified
+// against the same roots, but is not expected to match the pins of the Waldo
+// API.
+func (ts *tlsSettings) clientConfig(proxyHosts []string) *tls.Config {
+	config := ts.config.Clone()
+
+	if config.InsecureSkipVerify {
+		roots := config.RootCAs
+
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			return ts.verifyConnection(cs, roots, !slices.Contains(proxyHosts, cs.ServerName))
+		}
+	}
+
+	return config
+}
+
+// Loads the CA files and the client certificate, and checks the pins, so that
+// a misconfiguration is reported before anything is sent.
+func (ts *tlsSettings) load() error {
+	roots, err := x509.SystemCertPool()
+
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+
+	for _, caFile := range ts.caFiles {
+		data, err := os.ReadFile(caFile)
+
+		if err != nil {
+			return fmt.Errorf("Unable to read CA file %q, error: %v", caFile, err)
+		}
+
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("Unable to find any PEM certificate in CA file %q", caFile)
+		}
+	}
+
+	var certs []tls.Certificate
+
+	switch {
+	case len(ts.certFile) > 0 && len(ts.keyFile) > 0:
+		cert, err := tls.LoadX509KeyPair(ts.certFile, ts.keyFile)
+
+		if err != nil {
+			return fmt.Errorf("Unable to load client certificate %q with key %q, error: %v", ts.certFile, ts.keyFile, err)
+		}
+
+		certs = append(certs, cert)
+
+	case len(ts.certFile) > 0 || len(ts.keyFile) > 0:
+		return errors.New("Client certificate and key must be given together")
+	}
+
+	for idx, pin := range ts.pins {
+		pin = strings.TrimPrefix(pin, spkiPinPrefix)
+
+		if digest, err := base64.StdEncoding.DecodeString(pin); err != nil || len(digest) != sha256.Size {
+			return fmt.Errorf("Certificate pin %q is not a base64 SHA-256 digest", ts.pins[idx])
+		}
+
+		ts.pins[idx] = spkiPinPrefix + pin
+	}
+
+	ts.config = &tls.Config{
+		Certificates: certs}
+
+	// Only extra roots or pins need verifyConnection; otherwise the standard
+	// library verifies the chain as usual.
+	if len(ts.caFiles) > 0 || len(ts.pins) > 0 {
+		ts.config.InsecureSkipVerify = true
+		ts.config.RootCAs = roots
+	}
+
+	return nil
+}
+
+func (ts *tlsSettings) string() string {
+	parts := []string{"system roots"}
+
+	if len(ts.caFiles) > 0 {
+		parts[0] += fmt.Sprintf(" and %d CA file(s)", len(ts.caFiles))
+	}
+
+	if len(ts.certFile) > 0 {
+		parts = append(parts, "client certificate")
+	}
+
+	if len(ts.pins) > 0 {
+		parts = append(parts, fmt.Sprintf("%d pin(s)", len(ts.pins)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// Verifies the chain exactly as the standard library would, then requires a
+// pinned key somewhere in the verified chain, if any pins are set and apply.
+func (ts *tlsSettings) verifyConnection(cs tls.ConnectionState, roots *x509.CertPool, pinned bool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+		Roots:         roots}
+
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	chains, err := cs.PeerCertificates[0].Verify(opts)
+
+	if err != nil {
+		return newTLSVerifyError(cs.PeerCertificates, err)
+	}
+
+	if !pinned || len(ts.pins) == 0 {
+		return nil
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			for _, pin := range ts.pins {
+				if spkiPin(cert) == pin {
+					return nil
+				}
+			}
+		}
+	}
+
+	return newTLSVerifyError(cs.PeerCertificates, errors.New("no certificate matches the pinned keys"))
+}
+
+//-----------------------------------------------------------------------------
+
+func (tve *tlsVerifyError) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString(tve.err.Error())
+
+	if len(tve.hint) > 0 {
+		sb.WriteString(" (" + tve.hint + ")")
+	}
+
+	sb.WriteString(", server presented:")
+
+	for idx, cert := range tve.chain {
+		fmt.Fprintf(&sb, " [%d] %s;", idx, describeCertificate(cert))
+	}
+
+	return strings.TrimSuffix(sb.String(), ";")
+}
+
+func (tve *tlsVerifyError) Unwrap() error {
+	return tve.err
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a self-signed client certificate and writes it, along with its key,
+// as PEM files.
+func createTestClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotAfter:     time.Now().Add(time.Hour),
+		NotBefore:    time.Now().Add(-time.Hour),
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "waldo-agent-test"}}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, writeTestPEM(t, "client.crt", "CERTIFICATE", der), writeTestPEM(t, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func sendTLSTestRequest(t *testing.T, server *httptest.Server, ts *tlsSettings) error {
+	if err := ts.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	nc := newNetworkConfig(nil, nil, ts)
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := nc.timeouts.send(nc.newClient(false), req, time.Time{})
+
+	if err == nil {
+		resp.Body.Close()
+	}
+
+	return err
+}
+
+func writeTestPEM(t *testing.T, name, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+//-----------------------------------------------------------------------------
+
+func TestTLSSettingsClientCertificate(t *testing.T) {
+	clientCert, certFile, keyFile := createTestClientCert(t)
+
+	clientCAs := x509.NewCertPool()
+
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs}
+
+	server.StartTLS()
+
+	defer server.Close()
+
+	caFile := writeTestPEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	err := sendTLSTestRequest(t, server, newTLSSettings([]string{caFile}, "", "", nil))
+
+	if err == nil || !strings.Contains(err.Error(), "--client_cert") {
+		t.Errorf("Expected rejected handshake to mention the client certificate, got %v", err)
+	}
+
+	if err := sendTLSTestRequest(t, server, newTLSSettings([]string{caFile}, certFile, keyFile, nil)); err != nil {
+		t.Errorf("Expected mutual TLS to succeed, got %v", err)
+	}
+}
+
+func TestTLSSettingsLoad(t *testing.T) {
+	_, certFile, keyFile := createTestClientCert(t)
+
+	if err := newTLSSettings(nil, certFile, "", nil).load(); err == nil {
+		t.Error("Expected client certificate without key to be rejected")
+	}
+
+	if err := newTLSSettings([]string{keyFile}, "", "", nil).load(); err == nil {
+		t.Error("Expected CA file without certificate to be rejected")
+	}
+
+	if err := newTLSSettings(nil, "", "", []string{"sha256/not-a-digest"}).load(); err == nil {
+		t.Error("Expected invalid pin to be rejected")
+	}
+
+	ts := newTLSSettings(nil, certFile, keyFile, []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="})
+
+	if err := ts.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ts.pins[0] != "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=" {
+		t.Errorf("Expected pin to be normalized, got %q", ts.pins[0])
+	}
+
+	ts = newTLSSettings(nil, certFile, keyFile, nil)
+
+	if err := ts.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if config := ts.clientConfig(nil); config.InsecureSkipVerify || config.VerifyConnection != nil {
+		t.Error("Expected standard verification without CA files or pins")
+	}
+}
+
+func TestTLSSettingsProxyPins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	defer server.Close()
+
+	ts := newTLSSettings([]string{writeTestPEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)}, "", "", []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="})
+
+	if err := ts.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{server.Certificate()},
+		ServerName:       "example.com"}
+
+	if err := ts.clientConfig(nil).VerifyConnection(cs); err == nil || !strings.Contains(err.Error(), "pinned") {
+		t.Errorf("Expected pin mismatch, got %v", err)
+	}
+
+	// A proxy reached over TLS is verified, but not pinned.
+	if err := ts.clientConfig([]string{"example.com"}).VerifyConnection(cs); err != nil {
+		t.Errorf("Expected proxy to be trusted without pin, got %v", err)
+	}
+}
+
+func TestTLSSettingsVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	defer server.Close()
+
+	pin := spkiPin(server.Certificate())
+
+	err := sendTLSTestRequest(t, server, newTLSSettings(nil, "", "", nil))
+
+	if err == nil || !strings.Contains(err.Error(), "unknown authority") || !strings.Contains(err.Error(), "--ca_file") || !strings.Contains(err.Error(), pin) {
+		t.Errorf("Expected unknown authority diagnosis with presented chain, got %v", err)
+	}
+
+	if shouldRetryError(err, true) {
+		t.Error("Expected an untrusted server not to be retried")
+	}
+
+	caFile := writeTestPEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	if err := sendTLSTestRequest(t, server, newTLSSettings([]string{caFile}, "", "", []string{pin})); err != nil {
+		t.Errorf("Expected pinned server to be trusted, got %v", err)
+	}
+
+	err = sendTLSTestRequest(t, server, newTLSSettings([]string{caFile}, "", "", []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}))
+
+	if err == nil || !strings.Contains(err.Error(), "pinned") {
+		t.Errorf("Expected pin mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Records when each phase of a request happens, so that a slow or failed
+// request can be blamed on DNS, connecting, the TLS handshake, sending the
+// body or the server.
+type requestTrace struct {
+	addresses     []string
+	connectDone   time.Time
+	connectStart  time.Time
+	dnsDone       time.Time
+	dnsStart      time.Time
+	firstByte     time.Time
+	gotConn       time.Time
+	mutex         sync.Mutex
+	peerSubject   string
+	remoteAddress string
+	reused        bool
+	startTime     time.Time
+	stopTime      time.Time
+	tlsCipher     string
+	tlsDone       time.Time
+	tlsStart      time.Time
+	tlsVersion    string
+	wroteRequest  time.Time
+}
+
+//-----------------------------------------------------------------------------
+
+type NetworkTimingJSON struct {
+	Addresses     []string `json:"addresses,omitempty"`
+	ConnectMs     int64    `json:"connectMs,omitempty"`
+	DNSMs         int64    `json:"dnsMs,omitempty"`
+	FirstByteMs   int64    `json:"firstByteMs,omitempty"`
+	PeerSubject   string   `json:"peerSubject,omitempty"`
+	RemoteAddress string   `json:"remoteAddress,omitempty"`
+	Reused        bool     `json:"reused,omitempty"`
+	TLSCipher     string   `json:"tlsCipher,omitempty"`
+	TLSMs         int64    `json:"tlsMs,omitempty"`
+	TLSVersion    string   `json:"tlsVersion,omitempty"`
+	TotalMs       int64    `json:"totalMs"`
+	TransferMs    int64    `json:"transferMs,omitempty"`
+}
+
+//-----------------------------------------------------------------------------
+
+func newRequestTrace() *requestTrace {
+	return &requestTrace{
+		startTime: time.Now()}
+}
+
+//-----------------------------------------------------------------------------
+
+// Sends the request with a trace attached, and reports the timing of its
+// phases in verbose mode.
+func sendTraced(client *http.Client, nt *networkTimeouts, req *http.Request, deadline time.Time, verbose bool) (*http.Response, *requestTrace, error) {
+	rt := newRequestTrace()
+
+	resp, err := nt.send(client, rt.attach(req), deadline)
+
+	rt.stop()
+
+	if verbose {
+		fmt.Printf("\n--- Timing ---\n%s\n", rt.report())
+	}
+
+	return resp, rt, err
+}
+
+//-----------------------------------------------------------------------------
+
+func (rt *requestTrace) attach(req *http.Request) *http.Request {
+	ct := &httptrace.ClientTrace{
+		ConnectDone: func(network, addr string, err error) {
+			rt.update(func() {
+				if err == nil {
+					rt.connectDone = time.Now()
+				}
+			})
+		},
+		ConnectStart: func(network, addr string) {
+			rt.update(func() {
+				if rt.connectStart.IsZero() {
+					rt.connectStart = time.Now()
+				}
+			})
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			rt.update(func() {
+				rt.dnsDone = time.Now()
+
+				for _, addr := range info.Addrs {
+					rt.addresses = append(rt.addresses, addr.String())
+				}
+			})
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			rt.update(func() { rt.dnsStart = time.Now() })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			rt.update(func() {
+				rt.gotConn = time.Now()
+				rt.remoteAddress = info.Conn.RemoteAddr().String()
+				rt.reused = info.Reused
+			})
+		},
+		GotFirstResponseByte: func() {
+			rt.update(func() { rt.firstByte = time.Now() })
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			rt.update(func() {
+				if err != nil {
+					return
+				}
+
+				rt.tlsDone = time.Now()
+				rt.tlsCipher = tls.CipherSuiteName(cs.CipherSuite)
+				rt.tlsVersion = tls.VersionName(cs.Version)
+
+				if len(cs.PeerCertificates) > 0 {
+					rt.peerSubject = cs.PeerCertificates[0].Subject.String()
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			rt.update(func() { rt.tlsStart = time.Now() })
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			rt.update(func() {
+				if info.Err == nil {
+					rt.wroteRequest = time.Now()
+				}
+			})
+		}}
+
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), ct))
+}
+
+// The time to first byte is measured from the end of the request, so that it
+// reflects how long the server took, not how long the body took to send.
+func (rt *requestTrace) json() *NetworkTimingJSON {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	return &NetworkTimingJSON{
+		Addresses:     rt.addresses,
+		ConnectMs:     elapsedMs(rt.connectStart, rt.connectDone),
+		DNSMs:         elapsedMs(rt.dnsStart, rt.dnsDone),
+		FirstByteMs:   elapsedMs(rt.wroteRequest, rt.firstByte),
+		PeerSubject:   rt.peerSubject,
+		RemoteAddress: rt.remoteAddress,
+		Reused:        rt.reused,
+		TLSCipher:     rt.tlsCipher,
+		TLSMs:         elapsedMs(rt.tlsStart, rt.tlsDone),
+		TLSVersion:    rt.tlsVersion,
+		TotalMs:       elapsedMs(rt.startTime, rt.stopTime),
+		TransferMs:    elapsedMs(rt.gotConn, rt.wroteRequest)}
+}
+
+// Lists only the phases that completed, which shows where a failed request
+// stopped.
+func (rt *requestTrace) report() string {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	var lines []string
+
+	add := func(label string, from, to time.Time, details ...string) {
+		if from.IsZero() || to.IsZero() {
+			return
+		}
+
+		line := fmt.Sprintf("%-21s%v", label+":", to.Sub(from).Round(time.Millisecond))
+
+		details = slices.DeleteFunc(details, func(detail string) bool { return len(detail) == 0 })
+
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, ", ") + ")"
+		}
+
+		lines = append(lines, line)
+	}
+
+	if rt.reused {
+		lines = append(lines, fmt.Sprintf("%-21s%s", "Connection:", "reused to "+rt.remoteAddress))
+	}
+
+	add("DNS", rt.dnsStart, rt.dnsDone, strings.Join(rt.addresses, " "))
+	add("Connect", rt.connectStart, rt.connectDone, rt.remoteAddress)
+	add("TLS handshake", rt.tlsStart, rt.tlsDone, rt.tlsVersion, rt.tlsCipher, rt.peerSubject)
+	add("Transfer", rt.gotConn, rt.wroteRequest)
+	add("Time to first byte", rt.wroteRequest, rt.firstByte)
+	add("Total", rt.startTime, rt.stopTime)
+
+	return strings.Join(lines, "\n")
+}
+
+func (rt *requestTrace) stop() {
+	rt.update(func() { rt.stopTime = time.Now() })
+}
+
+func (rt *requestTrace) update(fn func()) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	fn()
+}
+
+//-----------------------------------------------------------------------------
+
+func elapsedMs(from, to time.Time) int64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+
+	return to.Sub(from).Milliseconds()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendTraced(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	defer server.Close()
+
+	ts := newTLSSettings([]string{writeTestPEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)}, "", "", nil)
+
+	if err := ts.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	nc := newNetworkConfig(nil, nil, ts)
+
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, rt, err := sendTraced(nc.newClient(false), nc.timeouts, req, time.Time{}, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	timing := rt.json()
+
+	if len(timing.TLSVersion) == 0 || len(timing.TLSCipher) == 0 || len(timing.PeerSubject) == 0 {
+		t.Errorf("Expected TLS details, got %+v", timing)
+	}
+
+	if timing.FirstByteMs < 20 || timing.TotalMs < timing.FirstByteMs {
+		t.Errorf("Expected time to first byte of at least 20ms within the total, got %+v", timing)
+	}
+
+	if report := rt.report(); !strings.Contains(report, "TLS handshake:") || !strings.Contains(report, "Time to first byte:") {
+		t.Errorf("Expected report of TLS handshake and time to first byte, got %q", report)
+	}
+
+	ua := newUploadAction("/some/path", "token", "", "", "", "", false, map[string]string{})
+
+	ua.ciInfo = &ciInfo{}
+	ua.failureTrace = rt
+
+	output, err := ua.makeErrorPayload(errors.New("Unable to upload build to Waldo"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload ErrorPayloadJSON
+
+	if err := json.Unmarshal([]byte(output), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.NetworkTiming == nil || payload.NetworkTiming.FirstByteMs != timing.FirstByteMs {
+		t.Errorf("Expected error payload to include network timing, got %s", output)
+	}
+}
@@ -4,22 +4,30 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type triggerAction struct {
 	userGitCommit   string
+	userNetwork     *networkConfig
 	userOverrides   map[string]string
+	userRetryPolicy *retryPolicy
 	userRuleName    string
 	userUploadToken string
 	userVerbose     bool
 
-	ciInfo    *ciInfo
-	rtInfo    *rtInfo
-	validated bool
+	ciInfo     *ciInfo
+	deadline   time.Time
+	httpClient *http.Client
+	retryAfter time.Duration
+	rtInfo     *rtInfo
+	validated  bool
 }
 
 //-----------------------------------------------------------------------------
 
+// The network and retry policy keep their defaults unless set after
+// construction.
 func newTriggerAction(uploadToken, ruleName, gitCommit string, verbose bool, overrides map[string]string) *triggerAction {
 	return &triggerAction{
 		rtInfo:          detectRTInfo(),
@@ -36,10 +44,30 @@ func (ta *triggerAction) gitCommit() string {
 	return ta.userGitCommit
 }
 
+func (ta *triggerAction) network() *networkConfig {
+	if ta.userNetwork == nil {
+		ta.userNetwork = newNetworkConfig(nil, nil, nil)
+	}
+
+	return ta.userNetwork
+}
+
+func (ta *triggerAction) retryPolicy() *retryPolicy {
+	if ta.userRetryPolicy == nil {
+		return newRetryPolicy(0, 0, 0)
+	}
+
+	return ta.userRetryPolicy
+}
+
 func (ta *triggerAction) ruleName() string {
 	return ta.userRuleName
 }
 
+func (ta *triggerAction) timeouts() *networkTimeouts {
+	return ta.network().timeouts
+}
+
 func (ta *triggerAction) uploadToken() string {
 	return ta.userUploadToken
 }
@@ -50,7 +78,19 @@ func (ta *triggerAction) version() string {
 
 //-----------------------------------------------------------------------------
 
+func (ta *triggerAction) setNetwork(nc *networkConfig) {
+	ta.userNetwork = nc
+}
+
+func (ta *triggerAction) setRetryPolicy(rp *retryPolicy) {
+	ta.userRetryPolicy = rp
+}
+
+//-----------------------------------------------------------------------------
+
 func (ta *triggerAction) perform() error {
+	ta.deadline = ta.timeouts().makeDeadline(time.Now())
+
 	return ta.triggerRunWithRetry()
 }
 
@@ -85,6 +125,14 @@ func (ta *triggerAction) checkTriggerStatus(resp *http.Response) error {
 	return nil
 }
 
+func (ta *triggerAction) client() *http.Client {
+	if ta.httpClient == nil {
+		ta.httpClient = ta.network().newClient(ta.userVerbose)
+	}
+
+	return ta.httpClient
+}
+
 func (ta *triggerAction) contentType() string {
 	return jsonContentType
 }
@@ -123,8 +171,6 @@ func (ta *triggerAction) triggerRun(retryAllowed bool) (bool, error) {
 	url := ta.makeURL()
 	body := ta.makePayload()
 
-	client := &http.Client{}
-
 	req, err := http.NewRequest("POST", url, strings.NewReader(body))
 
 	if err != nil {
@@ -137,22 +183,30 @@ func (ta *triggerAction) triggerRun(retryAllowed bool) (bool, error) {
 
 	dumpRequest(ta.userVerbose, req, true)
 
-	resp, err := client.Do(req)
+	resp, _, err := sendTraced(ta.client(), ta.timeouts(), req, ta.deadline, ta.userVerbose)
 
 	if err != nil {
-		return retryAllowed, fmt.Errorf("Unable to trigger run on Waldo, error: %v, url: %q", err, url)
+		return retryAllowed && shouldRetryError(err, false), fmt.Errorf("Unable to trigger run on Waldo, error: %v, url: %q", err, url)
 	}
 
 	dumpResponse(ta.userVerbose, resp, true)
 
 	defer resp.Body.Close()
 
-	return retryAllowed && shouldRetry(resp), ta.checkTriggerStatus(resp)
+	ta.retryAfter = parseRetryAfter(resp)
+
+	// Triggering a run is not idempotent, so only retry when the server
+	// promises that it did not trigger one.
+	return retryAllowed && shouldRetryNonIdempotent(resp), ta.checkTriggerStatus(resp)
 }
 
 func (ta *triggerAction) triggerRunWithRetry() error {
-	for attempts := 1; attempts <= maxNetworkAttempts; attempts++ {
-		retry, err := ta.triggerRun(attempts < maxNetworkAttempts)
+	rp := ta.retryPolicy()
+
+	for attempts := 1; ; attempts++ {
+		ta.retryAfter = 0
+
+		retry, err := ta.triggerRun(rp.isRetryAllowed(attempts))
 
 		if !retry || err == nil {
 			return err
@@ -160,11 +214,16 @@ func (ta *triggerAction) triggerRunWithRetry() error {
 
 		emitError(err)
 
-		fmt.Printf("\nFailed trigger attempts: %d -- retrying…\n\n", attempts)
-	}
+		delay := rp.delay(attempts, ta.retryAfter)
 
-	return nil
+		if !isBeforeDeadline(ta.deadline, delay) {
+			return err
+		}
+
+		fmt.Printf("\nFailed trigger attempts: %d -- retrying in %v…\n\n", attempts, delay.Round(time.Millisecond))
 
+		time.Sleep(delay)
+	}
 }
 
 func (ta *triggerAction) userAgent() string {
@@ -8,82 +8,129 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// The error report is sent once the upload has failed, possibly because its
+// deadline passed, so it gets a short budget of its own.
+const errorReportTimeout = 30 * time.Second
+
 //-----------------------------------------------------------------------------
 
 type uploadAction struct {
-	retryCount      int
-	userAppID       string
-	userBuildPath   string
-	userGitBranch   string
-	userGitCommit   string
-	userOverrides   map[string]string
-	userUploadToken string
-	userVariantName string
-	userVerbose     bool
+	retryCount           int
+	userAppID            string
+	userBuildPath        string
+	userCompressionLevel int
+	userGitBranch        string
+	userGitCommit        string
+	userMaxUploadRate    int64
+	userOverrides        map[string]string
+	userNetwork          *networkConfig
+	userRetryPolicy      *retryPolicy
+	userUploadMode       string
+	userUploadToken      string
+	userUploadWorkers    int
+	userVariantName      string
+	userVerbose          bool
 
 	absBuildPath        string
 	absBuildPayloadPath string
 	absWorkingPath      string
+	buildInfo           *buildInfo
 	buildSuffix         string
 	ciInfo              *ciInfo
+	deadline            time.Time
 	failureBody         any
+	failureMutex        sync.Mutex
 	failureHeaders      any
 	failureStatusCode   int
+	failureTrace        *requestTrace
 	flavor              string
 	gitInfo             *gitInfo
+	httpClient          *http.Client
+	payloadLinked       bool
+	payloadSHA256       string
+	progress            *progressReporter
+	rateLimiter         *rateLimiter
+	retryAfter          time.Duration
 	rtInfo              *rtInfo
 	uploadID            string
 	uploadMetadata      *UploadMetadata
+	uploadPartSize      int64
+	uploadSession       *UploadSession
 	validated           bool
 }
 
 //-----------------------------------------------------------------------------
 
+// The remaining options keep their defaults unless set after construction.
 func newUploadAction(buildPath, uploadToken, appID, variantName, gitCommit, gitBranch string, verbose bool, overrides map[string]string) *uploadAction {
 	return &uploadAction{
-		retryCount:      0,
-		rtInfo:          detectRTInfo(),
-		userAppID:       appID,
-		userBuildPath:   buildPath,
-		userGitBranch:   gitBranch,
-		userGitCommit:   gitCommit,
-		userOverrides:   overrides,
-		userUploadToken: uploadToken,
-		userVariantName: variantName,
-		userVerbose:     verbose}
+		retryCount:           0,
+		rtInfo:               detectRTInfo(),
+		uploadPartSize:       defaultUploadPartSize,
+		userAppID:            appID,
+		userBuildPath:        buildPath,
+		userCompressionLevel: defaultCompressionLevel,
+		userGitBranch:        gitBranch,
+		userGitCommit:        gitCommit,
+		userOverrides:        overrides,
+		userUploadToken:      uploadToken,
+		userVariantName:      variantName,
+		userVerbose:          verbose}
 }
 
 //-----------------------------------------------------------------------------
 
 type ErrorPayloadJSON struct {
-	AgentName         string `json:"agentName,omitempty"`
-	AgentVersion      string `json:"agentVersion,omitempty"`
-	Arch              string `json:"arch,omitempty"`
-	CI                string `json:"ci,omitempty"`
-	CIGitBranch       string `json:"ciGitBranch,omitempty"`
-	CIGitCommit       string `json:"ciGitCommit,omitempty"`
-	FailureBody       any    `json:"failureBody,omitempty"`
-	FailureHeaders    any    `json:"failureHeaders,omitempty"`
-	FailureStatusCode int    `json:"failureStatusCode"`
-	Message           string `json:"message,omitempty"`
-	Platform          string `json:"platform,omitempty"`
-	Retry             int    `json:"retry"`
-	WrapperName       string `json:"wrapperName,omitempty"`
-	WrapperVersion    string `json:"wrapperVersion,omitempty"`
+	AgentName         string             `json:"agentName,omitempty"`
+	AgentVersion      string             `json:"agentVersion,omitempty"`
+	Arch              string             `json:"arch,omitempty"`
+	CI                string             `json:"ci,omitempty"`
+	CIGitBranch       string             `json:"ciGitBranch,omitempty"`
+	CIGitCommit       string             `json:"ciGitCommit,omitempty"`
+	FailureBody       any                `json:"failureBody,omitempty"`
+	FailureHeaders    any                `json:"failureHeaders,omitempty"`
+	FailureStatusCode int                `json:"failureStatusCode"`
+	Message           string             `json:"message,omitempty"`
+	NetworkTiming     *NetworkTimingJSON `json:"networkTiming,omitempty"`
+	Platform          string             `json:"platform,omitempty"`
+	Retry             int                `json:"retry"`
+	WrapperName       string             `json:"wrapperName,omitempty"`
+	WrapperVersion    string             `json:"wrapperVersion,omitempty"`
 }
 
 //-----------------------------------------------------------------------------
 
+func (ua *uploadAction) androidManifest() *androidManifest {
+	if ua.buildInfo == nil {
+		return nil
+	}
+
+	return ua.buildInfo.androidManifest
+}
+
+func (ua *uploadAction) apkSetSelection() string {
+	return ua.buildInfo.apkSetSelection.string()
+}
+
 func (ua *uploadAction) appID() string {
 	return ua.userAppID
 }
 
+func (ua *uploadAction) appleBundleInfo() *appleBundleInfo {
+	if ua.buildInfo == nil {
+		return nil
+	}
+
+	return ua.buildInfo.appleBundleInfo
+}
+
 func (ua *uploadAction) buildPath() string {
 	if ua.validated {
 		return ua.absBuildPath
@@ -96,6 +143,10 @@ func (ua *uploadAction) buildPayloadPath() string {
 	return ua.absBuildPayloadPath
 }
 
+func (ua *uploadAction) bundleModules() []string {
+	return ua.buildInfo.bundleModules
+}
+
 func (ua *uploadAction) ciGitBranch() string {
 	return ua.ciInfo.gitBranch
 }
@@ -128,14 +179,66 @@ func (ua *uploadAction) inferredGitCommit() string {
 	return ua.gitInfo.commit
 }
 
+func (ua *uploadAction) maxUploadRate() string {
+	return ua.rateLimiter.string()
+}
+
+func (ua *uploadAction) nativeABIs() []string {
+	return ua.buildInfo.nativeABIs
+}
+
+func (ua *uploadAction) network() *networkConfig {
+	if ua.userNetwork == nil {
+		ua.userNetwork = newNetworkConfig(nil, nil, nil)
+	}
+
+	return ua.userNetwork
+}
+
 func (ua *uploadAction) retry() string {
 	return strconv.Itoa(ua.retryCount)
 }
 
+func (ua *uploadAction) retryPolicy() *retryPolicy {
+	if ua.userRetryPolicy == nil {
+		return newRetryPolicy(0, 0, 0)
+	}
+
+	return ua.userRetryPolicy
+}
+
+func (ua *uploadAction) signatureSchemes() []string {
+	return ua.buildInfo.signatureSchemes
+}
+
+func (ua *uploadAction) timeouts() *networkTimeouts {
+	return ua.network().timeouts
+}
+
+func (ua *uploadAction) uploadMode() string {
+	if len(ua.userUploadMode) == 0 {
+		return "single"
+	}
+
+	return ua.userUploadMode
+}
+
+func (ua *uploadAction) uploadStats() string {
+	return ua.progress.stats()
+}
+
 func (ua *uploadAction) uploadToken() string {
 	return ua.userUploadToken
 }
 
+func (ua *uploadAction) uploadWorkers() int {
+	if ua.userUploadWorkers <= 0 {
+		return defaultUploadWorkers
+	}
+
+	return ua.userUploadWorkers
+}
+
 func (ua *uploadAction) variantName() string {
 	return ua.userVariantName
 }
@@ -146,7 +249,36 @@ func (ua *uploadAction) version() string {
 
 //-----------------------------------------------------------------------------
 
+func (ua *uploadAction) setCompressionLevel(level int) {
+	ua.userCompressionLevel = level
+}
+
+func (ua *uploadAction) setMaxUploadRate(rate int64) {
+	ua.rateLimiter = newRateLimiter(rate)
+	ua.userMaxUploadRate = rate
+}
+
+func (ua *uploadAction) setNetwork(nc *networkConfig) {
+	ua.userNetwork = nc
+}
+
+func (ua *uploadAction) setRetryPolicy(rp *retryPolicy) {
+	ua.userRetryPolicy = rp
+}
+
+func (ua *uploadAction) setUploadMode(mode string) {
+	ua.userUploadMode = mode
+}
+
+func (ua *uploadAction) setUploadWorkers(workers int) {
+	ua.userUploadWorkers = workers
+}
+
+//-----------------------------------------------------------------------------
+
 func (ua *uploadAction) perform() error {
+	ua.deadline = ua.timeouts().makeDeadline(time.Now())
+
 	err := os.RemoveAll(ua.absWorkingPath)
 
 	if err == nil {
@@ -155,11 +287,11 @@ func (ua *uploadAction) perform() error {
 
 	defer os.RemoveAll(ua.absWorkingPath)
 
-	if err == nil {
+	if err == nil && !ua.isStreamingPayload() {
 		err = ua.createBuildPayload()
 	}
 
-	if err == nil {
+	if err == nil && !ua.linkExistingBuild() {
 		err = ua.uploadBuildWithRetry()
 	}
 
@@ -175,17 +307,28 @@ func (ua *uploadAction) validate() error {
 		return nil
 	}
 
+	if !slices.Contains(uploadModes, ua.uploadMode()) {
+		return fmt.Errorf("Upload mode %q is not recognized, must be one of: %s", ua.uploadMode(), strings.Join(uploadModes, ", "))
+	}
+
 	buildPath, buildSuffix, flavor, err := validateBuildPath(ua.userBuildPath)
 
 	if err != nil {
 		return err
 	}
 
+	bi, err := inspectBuildInfo(buildPath, buildSuffix)
+
+	if err != nil {
+		return err
+	}
+
 	workingPath := determineWorkingPath()
 
 	ua.absBuildPath = buildPath
-	ua.absBuildPayloadPath = determineBuildPayloadPath(workingPath, buildPath, buildSuffix)
+	ua.absBuildPayloadPath = determineBuildPayloadPath(workingPath, buildPath, buildSuffix, bi)
 	ua.absWorkingPath = workingPath
+	ua.buildInfo = bi
 	ua.buildSuffix = buildSuffix
 	ua.ciInfo = detectCIInfo(true)
 	ua.flavor = flavor
@@ -202,8 +345,27 @@ func (ua *uploadAction) authorization() string {
 	return fmt.Sprintf("Upload-Token %s", ua.userUploadToken)
 }
 
+// Paces the body to the maximum upload rate, if any, and reports the bytes as
+// they are sent.
+func (ua *uploadAction) bodyReader(reader io.Reader) io.Reader {
+	return ua.rateLimiter.reader(ua.progress.reader(reader))
+}
+
 func (ua *uploadAction) buildContentType() string {
-	return binaryContentType
+	switch ua.buildSuffix {
+	case "aab":
+		return bundleContentType
+
+	case "apks":
+		if !ua.buildInfo.apkSetSelection.isSingleAPK() {
+			return apkSetContentType
+		}
+
+		return binaryContentType
+
+	default:
+		return binaryContentType
+	}
 }
 
 func (ua *uploadAction) checkBuildStatus(resp *http.Response) error {
@@ -238,28 +400,34 @@ func (ua *uploadAction) checkErrorStatus(resp *http.Response) error {
 	return nil
 }
 
-func (ua *uploadAction) createBuildPayload() error {
-	parentPath := filepath.Dir(ua.absBuildPath)
-	buildName := filepath.Base(ua.absBuildPath)
+// Shares one client, and therefore its pooled connections and its proxy, across
+// the many requests of an upload and the report of its failure.
+func (ua *uploadAction) client() *http.Client {
+	if ua.httpClient == nil {
+		ua.httpClient = ua.network().newClient(ua.userVerbose)
+	}
 
-	switch ua.buildSuffix {
-	case "apk":
-		if !isRegular(ua.absBuildPath) {
-			return fmt.Errorf("Unable to read build at %q", ua.absBuildPath)
-		}
+	return ua.httpClient
+}
 
-		return nil
+func (ua *uploadAction) createBuildPayload() error {
+	return writeBuildPayload(ua.absBuildPayloadPath, ua.absBuildPath, ua.buildSuffix, ua.buildInfo, ua.userCompressionLevel)
+}
 
-	case "app":
-		if !isDir(ua.absBuildPath) {
-			return fmt.Errorf("Unable to read build at %q", ua.absBuildPath)
-		}
+// Takes the bytes read from the section of a failed request back out of the
+// progress, since they will be sent again.
+func (ua *uploadAction) discardProgress(section *io.SectionReader) {
+	read, _ := section.Seek(0, io.SeekCurrent)
 
-		return zipFolder(ua.absBuildPayloadPath, parentPath, buildName)
+	ua.progress.subtract(read)
+}
 
-	default:
-		return fmt.Errorf("Unable to read build at %q", ua.absBuildPath)
+func (ua *uploadAction) ensureBuildPayload() error {
+	if isRegular(ua.absBuildPayloadPath) {
+		return nil
 	}
+
+	return ua.createBuildPayload()
 }
 
 func (ua *uploadAction) errorContentType() string {
@@ -273,11 +441,20 @@ func (ua *uploadAction) extractUploadMetadata(resp *http.Response, host string)
 		return nil, err
 	}
 
-	return &UploadMetadata{
-		AppID:        ur.AppID,
-		AppVersionID: ur.AppVersionID,
-		Host:         host,
-		UploadTime:   time.Now()}, nil
+	um := &UploadMetadata{
+		AppID:         ur.AppID,
+		AppVersionID:  ur.AppVersionID,
+		ArchiveScheme: ua.buildInfo.archiveScheme,
+		Host:          host,
+		Linked:        ua.payloadLinked,
+		SHA256:        ua.payloadSHA256,
+		UploadTime:    time.Now()}
+
+	if !ua.buildInfo.archiveCreationDate.IsZero() {
+		um.ArchiveCreationDate = ua.buildInfo.archiveCreationDate.Format(time.RFC3339)
+	}
+
+	return um, nil
 }
 
 func (ua *uploadAction) fetchBody(resp *http.Response) any {
@@ -298,6 +475,16 @@ func (ua *uploadAction) fetchBody(resp *http.Response) any {
 	return jsonBody
 }
 
+func (ua *uploadAction) isStreamingPayload() bool {
+	switch ua.buildSuffix {
+	case "app", "xcarchive":
+		return ua.uploadMode() == "stream"
+
+	default:
+		return false
+	}
+}
+
 func (ua *uploadAction) isWAFResponse(resp *http.Response) bool {
 	server := resp.Header.Get("Server")
 
@@ -308,7 +495,14 @@ func (ua *uploadAction) isWAFResponse(resp *http.Response) bool {
 	return strings.HasPrefix(server, "awselb/")
 }
 
-func (ua *uploadAction) makeBuildURL() string {
+func (ua *uploadAction) lastRetryAfter() time.Duration {
+	ua.failureMutex.Lock()
+	defer ua.failureMutex.Unlock()
+
+	return ua.retryAfter
+}
+
+func (ua *uploadAction) makeBuildEndpoint() string {
 	buildURL := ua.userOverrides["apiBuildEndpoint"]
 
 	if len(buildURL) == 0 {
@@ -319,6 +513,10 @@ func (ua *uploadAction) makeBuildURL() string {
 		}
 	}
 
+	return buildURL
+}
+
+func (ua *uploadAction) makeBuildQuery() string {
 	query := make(url.Values)
 
 	addIfNotEmpty(&query, "agentName", agentName)
@@ -339,9 +537,32 @@ func (ua *uploadAction) makeBuildURL() string {
 	addIfNotEmpty(&query, "wrapperName", ua.userOverrides["wrapperName"])
 	addIfNotEmpty(&query, "wrapperVersion", ua.userOverrides["wrapperVersion"])
 
-	buildURL += "?" + query.Encode()
+	if am := ua.androidManifest(); am != nil {
+		addIfNotEmpty(&query, "debuggable", am.debuggableString())
+		addIfNotEmpty(&query, "launcherActivity", am.launcherActivity)
+		addIfNotEmpty(&query, "minSdkVersion", am.minSdkVersion)
+		addIfNotEmpty(&query, "nativeAbis", strings.Join(ua.nativeABIs(), ","))
+		addIfNotEmpty(&query, "packageName", am.packageName)
+		addIfNotEmpty(&query, "signatureSchemes", strings.Join(ua.signatureSchemes(), ","))
+		addIfNotEmpty(&query, "targetSdkVersion", am.targetSdkVersion)
+		addIfNotEmpty(&query, "versionCode", am.versionCode)
+		addIfNotEmpty(&query, "versionName", am.versionName)
+	}
 
-	return buildURL
+	if abi := ua.appleBundleInfo(); abi != nil {
+		addIfNotEmpty(&query, "bundleExecutable", abi.executable)
+		addIfNotEmpty(&query, "bundleIdentifier", abi.identifier)
+		addIfNotEmpty(&query, "bundleShortVersion", abi.shortVersion)
+		addIfNotEmpty(&query, "bundleVersion", abi.version)
+		addIfNotEmpty(&query, "deviceFamily", abi.deviceFamily())
+		addIfNotEmpty(&query, "minimumOSVersion", abi.minOSVersion)
+	}
+
+	return query.Encode()
+}
+
+func (ua *uploadAction) makeBuildURL() string {
+	return ua.makeBuildEndpoint() + "?" + ua.makeBuildQuery()
 }
 
 func (ua *uploadAction) makeErrorPayload(err error) (string, error) {
@@ -362,6 +583,10 @@ func (ua *uploadAction) makeErrorPayload(err error) (string, error) {
 		WrapperVersion:    ua.userOverrides["wrapperVersion"],
 	}
 
+	if ua.failureTrace != nil {
+		payload.NetworkTiming = ua.failureTrace.json()
+	}
+
 	data, err := json.Marshal(payload)
 
 	if err != nil {
@@ -381,38 +606,39 @@ func (ua *uploadAction) makeErrorURL() string {
 	return errorURL
 }
 
-func (ua *uploadAction) uploadBuild(retryAllowed bool) (bool, error) {
-	fmt.Printf("Uploading build to Waldo…\n")
+func (ua *uploadAction) recordFailure(resp *http.Response) {
+	ua.failureMutex.Lock()
+	defer ua.failureMutex.Unlock()
 
-	url := ua.makeBuildURL()
+	ua.failureBody = ua.fetchBody(resp)
+	ua.failureHeaders = resp.Header
+	ua.failureStatusCode = resp.StatusCode
+	ua.retryAfter = parseRetryAfter(resp)
+}
 
-	file, err := os.Open(ua.absBuildPayloadPath)
+func (ua *uploadAction) saveUploadMetadata(resp *http.Response) {
+	um, err := ua.extractUploadMetadata(resp, resp.Request.URL.Host)
 
-	if err != nil {
-		return false, ua.wrapUploadError("build", err, url)
+	if err == nil {
+		err = um.save()
 	}
 
-	defer file.Close()
-
-	fi, err := file.Stat()
-
-	if err != nil {
-		return false, ua.wrapUploadError("build", err, url)
+	if err == nil {
+		ua.uploadMetadata = um
+	} else {
+		emitError(fmt.Errorf("Unable to save upload metadata locally, error: %v", err))
 	}
+}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSHandshakeTimeout:   0,
-			ResponseHeaderTimeout: 0,
-			ExpectContinueTimeout: 0}}
-
-	req, err := http.NewRequest("POST", url, file)
+// A negative content length sends the body with chunked transfer encoding.
+func (ua *uploadAction) sendBuild(url string, body io.Reader, contentLength int64, retryAllowed bool) (bool, error) {
+	req, err := http.NewRequest("POST", url, body)
 
 	if err != nil {
 		return false, ua.wrapUploadError("build", err, url)
 	}
 
-	req.ContentLength = fi.Size()
+	req.ContentLength = contentLength
 
 	req.Header.Add("Authorization", ua.authorization())
 	req.Header.Add("Content-Type", ua.buildContentType())
@@ -421,10 +647,12 @@ func (ua *uploadAction) uploadBuild(retryAllowed bool) (bool, error) {
 
 	dumpRequest(ua.userVerbose, req, false)
 
-	resp, err := client.Do(req)
+	resp, err := ua.sendRequest(req)
 
+	// The server keeps a single build per X-Upload-Id, so sending the same
+	// build again is safe.
 	if err != nil {
-		return retryAllowed, ua.wrapUploadError("build", err, url)
+		return retryAllowed && shouldRetryError(err, true), ua.wrapUploadError("build", err, url)
 	}
 
 	dumpResponse(ua.userVerbose, resp, true)
@@ -434,30 +662,89 @@ func (ua *uploadAction) uploadBuild(retryAllowed bool) (bool, error) {
 	err = ua.checkBuildStatus(resp)
 
 	if err == nil {
-		um, err2 := ua.extractUploadMetadata(resp, req.URL.Host)
+		ua.saveUploadMetadata(resp)
+	} else {
+		ua.recordFailure(resp)
+	}
 
-		if err2 == nil {
-			err2 = um.save()
-		}
+	return retryAllowed && shouldRetry(resp), err
+}
 
-		if err2 == nil {
-			ua.uploadMetadata = um
-		} else {
-			emitError(fmt.Errorf("Unable to save upload metadata locally, error: %v", err2))
-		}
+// Keeps the trace of the latest request for the error payload, but only while
+// it failed, so that a later success does not leave a stale trace behind.
+func (ua *uploadAction) sendRequest(req *http.Request) (*http.Response, error) {
+	resp, rt, err := sendTraced(ua.client(), ua.timeouts(), req, ua.deadline, ua.userVerbose)
+
+	ua.failureMutex.Lock()
+	defer ua.failureMutex.Unlock()
+
+	if err != nil || resp.StatusCode >= 400 {
+		ua.failureTrace = rt
 	} else {
-		ua.failureBody = ua.fetchBody(resp)
-		ua.failureHeaders = resp.Header
-		ua.failureStatusCode = resp.StatusCode
+		ua.failureTrace = nil
 	}
 
-	return retryAllowed && shouldRetry(resp), err
+	return resp, err
+}
+
+func (ua *uploadAction) startProgress(total int64) {
+	ua.progress = newProgressReporter(total)
+}
+
+func (ua *uploadAction) uploadBuild(retryAllowed bool) (bool, error) {
+	fmt.Printf("Uploading build to Waldo…\n")
+
+	url := ua.makeBuildURL()
+
+	file, err := os.Open(ua.absBuildPayloadPath)
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, url)
+	}
+
+	defer file.Close()
+
+	fi, err := file.Stat()
+
+	if err != nil {
+		return false, ua.wrapUploadError("build", err, url)
+	}
+
+	ua.startProgress(fi.Size())
+
+	defer ua.progress.finish()
+
+	return ua.sendBuild(url, ua.bodyReader(file), fi.Size(), retryAllowed)
 }
 
+func (ua *uploadAction) uploadBuildPayload(retryAllowed bool) (bool, error) {
+	switch ua.uploadMode() {
+	case "chunked":
+		return ua.uploadBuildChunked(retryAllowed)
+
+	case "delta":
+		return ua.uploadBuildDelta(retryAllowed)
+
+	case "multipart":
+		return ua.uploadBuildMultipart(retryAllowed)
+
+	case "stream":
+		return ua.uploadBuildStream(retryAllowed)
+
+	default:
+		return ua.uploadBuild(retryAllowed)
+	}
+}
+
+// Every request of an upload carries the same upload ID, which lets the
+// server recognize a repeated request, so any failure can be retried.
 func (ua *uploadAction) uploadBuildWithRetry() error {
-	for attempts := 1; attempts <= maxNetworkAttempts; attempts++ {
+	rp := ua.retryPolicy()
+
+	for attempts := 1; ; attempts++ {
+		ua.retryAfter = 0
 		ua.retryCount = attempts - 1
-		retry, err := ua.uploadBuild(attempts < maxNetworkAttempts)
+		retry, err := ua.uploadBuildPayload(rp.isRetryAllowed(attempts))
 
 		if !retry || err == nil {
 			return err
@@ -465,13 +752,19 @@ func (ua *uploadAction) uploadBuildWithRetry() error {
 
 		emitError(err)
 
-		fmt.Printf("\nFailed upload attempts: %d -- retrying…\n\n", attempts)
-	}
+		delay := rp.delay(attempts, ua.retryAfter)
 
-	return nil
+		if !isBeforeDeadline(ua.deadline, delay) {
+			return err
+		}
+
+		fmt.Printf("\nFailed upload attempts: %d -- retrying in %v…\n\n", attempts, delay.Round(time.Millisecond))
+
+		time.Sleep(delay)
+	}
 }
 
-func (ua *uploadAction) uploadError(err error, retryAllowed bool) (bool, error) {
+func (ua *uploadAction) uploadError(err error, deadline time.Time, retryAllowed bool) (bool, error) {
 	url := ua.makeErrorURL()
 
 	body, err := ua.makeErrorPayload(err)
@@ -480,8 +773,6 @@ func (ua *uploadAction) uploadError(err error, retryAllowed bool) (bool, error)
 		return false, err
 	}
 
-	client := &http.Client{}
-
 	req, err := http.NewRequest("POST", url, strings.NewReader(body))
 
 	if err != nil {
@@ -497,22 +788,35 @@ func (ua *uploadAction) uploadError(err error, retryAllowed bool) (bool, error)
 
 	dumpRequest(ua.userVerbose, req, true)
 
-	resp, err := client.Do(req)
+	nt := *ua.timeouts()
+
+	nt.deadline = errorReportTimeout
 
+	resp, _, err := sendTraced(ua.client(), &nt, req, deadline, ua.userVerbose)
+
+	// A repeated report would show up twice, so it is not idempotent.
 	if err != nil {
-		return retryAllowed, ua.wrapUploadError("error", err, url)
+		return retryAllowed && shouldRetryError(err, false), ua.wrapUploadError("error", err, url)
 	}
 
 	dumpResponse(ua.userVerbose, resp, true)
 
 	defer resp.Body.Close()
 
-	return retryAllowed && shouldRetry(resp), ua.checkErrorStatus(resp)
+	ua.retryAfter = parseRetryAfter(resp)
+
+	return retryAllowed && shouldRetryNonIdempotent(resp), ua.checkErrorStatus(resp)
 }
 
 func (ua *uploadAction) uploadErrorWithRetry(err error) error {
-	for attempts := 1; attempts <= maxNetworkAttempts; attempts++ {
-		retry, tmpErr := ua.uploadError(err, attempts < maxNetworkAttempts)
+	rp := ua.retryPolicy()
+
+	deadline := time.Now().Add(errorReportTimeout)
+
+	for attempts := 1; ; attempts++ {
+		ua.retryAfter = 0
+
+		retry, tmpErr := ua.uploadError(err, deadline, rp.isRetryAllowed(attempts))
 
 		if !retry || tmpErr == nil {
 			return tmpErr
@@ -521,9 +825,15 @@ func (ua *uploadAction) uploadErrorWithRetry(err error) error {
 		// emitError(tmpErr)
 
 		// fmt.Printf("\nFailed upload error attempts: %d -- retrying…\n\n", attempts)
-	}
 
-	return nil
+		delay := rp.delay(attempts, ua.retryAfter)
+
+		if !isBeforeDeadline(deadline, delay) {
+			return tmpErr
+		}
+
+		time.Sleep(delay)
+	}
 }
 
 func (ua *uploadAction) userAgent() string {
@@ -5,15 +5,25 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/fs"
 	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
 )
 
+func appendIfMissing(values []string, value string) []string {
+	if slices.Contains(values, value) {
+		return values
+	}
+
+	return append(values, value)
+}
+
 func appendIfNotEmpty(payload *string, key string, value string) {
 	if len(key) == 0 || len(value) == 0 {
 		return
@@ -26,13 +36,23 @@ func appendIfNotEmpty(payload *string, key string, value string) {
 	*payload += fmt.Sprintf("%q:%q", key, value)
 }
 
-func determineBuildPayloadPath(workingPath, buildPath, buildSuffix string) string {
+func determineBuildPayloadPath(workingPath, buildPath, buildSuffix string, bi *buildInfo) string {
 	buildName := filepath.Base(buildPath)
 
 	switch buildSuffix {
-	case "app":
+	case "apks":
+		if bi.apkSetSelection.isSingleAPK() {
+			return filepath.Join(workingPath, filepath.Base(bi.apkSetSelection.paths[0]))
+		}
+
+		return filepath.Join(workingPath, buildName)
+
+	case "app", "xcarchive":
 		return filepath.Join(workingPath, buildName+".zip")
 
+	case "ipa", "tar.gz", "tgz":
+		return filepath.Join(workingPath, strings.TrimSuffix(buildName, "."+buildSuffix)+".zip")
+
 	default:
 		return buildPath
 	}
@@ -62,6 +82,26 @@ func isRegular(path string) bool {
 	return fi.Mode().IsRegular()
 }
 
+func measurePath(path string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(path, func(walkPath string, de fs.DirEntry, err error) error {
+		if err != nil || !de.Type().IsRegular() {
+			return err
+		}
+
+		fi, err := de.Info()
+
+		if err == nil {
+			size += fi.Size()
+		}
+
+		return err
+	})
+
+	return size, err
+}
+
 func randomUploadID() string {
 	uuid, err := uuid.NewRandom()
 
@@ -104,11 +144,18 @@ func validateBuildPath(buildPath string) (string, string, string, error) {
 
 	buildSuffix := strings.TrimPrefix(filepath.Ext(buildPath), ".")
 
+	if buildSuffix == "gz" && strings.HasSuffix(buildPath, ".tar.gz") {
+		buildSuffix = "tar.gz"
+	}
+
 	switch buildSuffix {
-	case "apk":
+	case "aab":
+		return buildPath, buildSuffix, "AndroidBundle", nil
+
+	case "apk", "apks":
 		return buildPath, buildSuffix, "Android", nil
 
-	case "app":
+	case "app", "ipa", "tar.gz", "tgz", "xcarchive", "zip":
 		return buildPath, buildSuffix, "iOS", nil
 
 	default:
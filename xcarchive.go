@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func findXcodeArchiveApp(archivePath string, archiveInfo map[string]any) (string, error) {
+	productsPath := filepath.Join(archivePath, "Products")
+
+	if appPath := plistString(plistDict(archiveInfo, "ApplicationProperties"), "ApplicationPath"); len(appPath) > 0 {
+		appPath = filepath.Join(productsPath, filepath.FromSlash(appPath))
+
+		if isDir(appPath) {
+			return appPath, nil
+		}
+	}
+
+	appPaths, err := filepath.Glob(filepath.Join(productsPath, "Applications", "*.app"))
+
+	if err != nil {
+		return "", err
+	}
+
+	switch len(appPaths) {
+	case 0:
+		return "", fmt.Errorf("Unable to find app in archive at %q", archivePath)
+
+	case 1:
+		return appPaths[0], nil
+
+	default:
+		names := make([]string, len(appPaths))
+
+		for idx, appPath := range appPaths {
+			names[idx] = filepath.Base(appPath)
+		}
+
+		return "", fmt.Errorf("Found more than one app in archive at %q (%s)", archivePath, strings.Join(names, ", "))
+	}
+}
+
+func inspectXcodeArchive(archivePath string) (*buildInfo, error) {
+	if !isDir(archivePath) {
+		return nil, fmt.Errorf("Unable to read archive at %q", archivePath)
+	}
+
+	data, err := os.ReadFile(filepath.Join(archivePath, infoPlistName))
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read %q in archive at %q, error: %v", infoPlistName, archivePath, err)
+	}
+
+	archiveInfo, err := parsePlistDict(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %q in archive at %q, error: %v", infoPlistName, archivePath, err)
+	}
+
+	appPath, err := findXcodeArchiveApp(archivePath, archiveInfo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bi, err := inspectApp(appPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bi.archiveCreationDate = plistDate(archiveInfo, "CreationDate")
+	bi.archiveScheme = plistString(archiveInfo, "SchemeName")
+
+	if len(bi.archiveScheme) == 0 {
+		bi.archiveScheme = plistString(archiveInfo, "Name")
+	}
+
+	return bi, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"debug/macho"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectXcodeArchive(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "MyApp.xcarchive")
+	appPath := filepath.Join(archivePath, "Products", "Applications", "MyApp.app")
+
+	if err := os.MkdirAll(appPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(archivePath, "Info.plist"), []byte(testXMLPlist), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(appPath, "Info.plist"), []byte(testAppInfoPlist), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(appPath, "MyApp"), makeTestMachO(macho.CpuArm64, machoLoadCmdBuildVersion, machoPlatformIOSSimulator), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	bi, err := inspectXcodeArchive(archivePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bi.appPath != appPath {
+		t.Errorf("Expected %q, got %q", appPath, bi.appPath)
+	}
+
+	if bi.archiveScheme != "MyApp-Release" {
+		t.Errorf("Expected \"MyApp-Release\", got %q", bi.archiveScheme)
+	}
+
+	if bi.archiveCreationDate.IsZero() {
+		t.Errorf("Expected creation date to be set")
+	}
+}
+
+func TestInspectXcodeArchiveWithoutApp(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "MyApp.xcarchive")
+
+	if err := os.MkdirAll(archivePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(archivePath, "Info.plist"), []byte(testXMLPlist), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := inspectXcodeArchive(archivePath); err == nil {
+		t.Errorf("Expected error for archive without app")
+	}
+}
@@ -2,19 +2,152 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"hash/crc32"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
-func zipFolder(zipPath string, folderPath string, basePath string) error {
-	err := os.Chdir(folderPath)
+const (
+	defaultCompressionLevel = flate.DefaultCompression
+
+	// Larger files are compressed by a worker into a temporary file rather
+	// than being buffered in memory.
+	zipBufferedSizeLimit = 32 * 1024 * 1024
+
+	// Bounds the bytes of buffered files that are being compressed or are
+	// waiting for their turn to be written to the archive.
+	zipWindowSize = 256 * 1024 * 1024
+
+	zipEpochDate = 1<<5 | 1 // 1980-01-01 in MS-DOS format
+	zipUTF8Flag  = 0x800
+)
+
+type zipEntry struct {
+	data      []byte
+	err       error
+	header    *zip.FileHeader
+	path      string
+	size      int64
+	spillPath string
+}
+
+type zipWindow struct {
+	closed bool
+	cond   *sync.Cond
+	limit  int64
+	used   int64
+}
+
+//-----------------------------------------------------------------------------
+
+// Deflating these again costs time for little or no gain.
+var compressedFileExtensions = []string{
+	".car",
+	".gif",
+	".gz",
+	".heic",
+	".jpeg",
+	".jpg",
+	".m4a",
+	".mov",
+	".mp3",
+	".mp4",
+	".png",
+	".webp",
+	".zip"}
+
+//-----------------------------------------------------------------------------
+
+func copyZipFile(zipWriter *zip.Writer, file *zip.File, name string) error {
+	reader, err := file.OpenRaw()
+
+	if err != nil {
+		return err
+	}
+
+	fh := file.FileHeader
+
+	fh.Name = name
+
+	writer, err := zipWriter.CreateRaw(&fh)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, reader)
+
+	return err
+}
+
+func countZipFiles(zipPath string) (int, error) {
+	zr, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer zr.Close()
+
+	count := 0
+
+	for _, file := range zr.File {
+		if !file.FileInfo().IsDir() {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func findZipFile(zr *zip.Reader, name string) *zip.File {
+	for _, file := range zr.File {
+		if file.Name == name {
+			return file
+		}
+	}
+
+	return nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// Copies the entries of a zip file, without recompressing them, ordered by
+// name.
+func sortZipFile(zipPath, srcPath string) error {
+	zr, err := zip.OpenReader(srcPath)
 
 	if err != nil {
 		return err
 	}
 
+	defer zr.Close()
+
+	files := slices.Clone(zr.File)
+
+	slices.SortStableFunc(files, func(a, b *zip.File) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
 	zipFile, err := os.Create(zipPath)
 
 	if err != nil {
@@ -25,41 +158,453 @@ func zipFolder(zipPath string, folderPath string, basePath string) error {
 
 	zipWriter := zip.NewWriter(zipFile)
 
-	walker := func(path string, entry fs.DirEntry, err error) error {
+	for _, file := range files {
+		if err := copyZipFile(zipWriter, file, file.Name); err != nil {
+			zipWriter.Close()
+
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+// Stores entries relative to the folder, with forward slashes, their Unix
+// mode bits and symlinks as links, so that framework `Versions/Current`
+// links are neither followed nor duplicated.
+func writeFolderZip(w io.Writer, folderPath string, basePath string, level int) error {
+	var entries []*zipEntry
+
+	err := filepath.WalkDir(filepath.Join(folderPath, basePath), func(path string, de fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if entry.IsDir() {
-			return nil
+		ze, err := newFolderZipEntry(folderPath, path, de, level)
+
+		if ze != nil {
+			entries = append(entries, ze)
 		}
 
-		file, err := os.Open(path)
+		return err
+	})
 
-		if err != nil {
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(entries, func(a, b *zipEntry) int {
+		return strings.Compare(a.header.Name, b.header.Name)
+	})
+
+	zipWriter := zip.NewWriter(w)
+
+	err = writeZipEntries(zipWriter, entries, level)
+
+	err2 := zipWriter.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return err2
+}
+
+// Compresses files concurrently across all CPUs, but writes them to the
+// archive in their original order. The window bounds how many bytes of
+// buffered files are held in memory while waiting for their turn; larger
+// files are spilled to a temporary folder instead.
+func writeZipEntries(zipWriter *zip.Writer, entries []*zipEntry, level int) error {
+	spillDir, err := os.MkdirTemp("", "waldo-zip-")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(spillDir)
+
+	var wg sync.WaitGroup
+
+	workers := runtime.NumCPU()
+	jobs := make(chan int)
+	results := make([]chan *zipEntry, len(entries))
+	window := newZipWindow(zipWindowSize)
+
+	for idx := range results {
+		results[idx] = make(chan *zipEntry, 1)
+	}
+
+	defer wg.Wait() // the workers must be done with the spill folder first
+	defer window.close()
+
+	go func() {
+		defer close(jobs)
+
+		for idx := range entries {
+			if !window.acquire(entries[idx].bufferedSize()) {
+				return
+			}
+
+			jobs <- idx
+		}
+	}()
+
+	for range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range jobs {
+				entries[idx].compress(level, spillDir)
+
+				results[idx] <- entries[idx]
+			}
+		}()
+	}
+
+	for idx := range entries {
+		ze := <-results[idx]
+
+		if err := ze.write(zipWriter); err != nil {
 			return err
 		}
 
-		defer file.Close()
+		window.release(ze.bufferedSize())
+	}
+
+	return nil
+}
+
+func zipFolder(zipPath string, folderPath string, basePath string, level int) error {
+	zipFile, err := os.Create(zipPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer zipFile.Close()
+
+	return writeFolderZip(zipFile, folderPath, basePath, level)
+}
+
+//-----------------------------------------------------------------------------
+
+func newFolderZipEntry(folderPath, path string, de fs.DirEntry, level int) (*zipEntry, error) {
+	fi, err := de.Info()
+
+	if err != nil {
+		return nil, err
+	}
+
+	relPath, err := filepath.Rel(folderPath, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fh, err := zip.FileInfoHeader(fi)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fh.Name = filepath.ToSlash(relPath)
+
+	ze := &zipEntry{
+		header: fh,
+		path:   path}
+
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		fh.Method = zip.Store
+		fh.Name += "/"
+
+		ze.setData(nil) // the size reported by the filesystem is not content
 
-		zipEntry, err := zipWriter.Create(path)
+	case mode&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ze.setData([]byte(filepath.ToSlash(target)))
+
+	case mode.IsRegular():
+		if level != flate.NoCompression && !isCompressedFile(path) {
+			fh.Method = zip.Deflate
+		}
+
+		ze.size = fi.Size()
+
+	default:
+		return nil, nil // sockets, devices and the like have no place in a build
+	}
+
+	normalizeZipHeader(fh)
+
+	return ze, nil
+}
+
+func newZipWindow(limit int64) *zipWindow {
+	return &zipWindow{
+		cond:  sync.NewCond(&sync.Mutex{}),
+		limit: limit}
+}
+
+//-----------------------------------------------------------------------------
+
+// Counts against the window only the files that are buffered in memory.
+func (ze *zipEntry) bufferedSize() int64 {
+	if ze.size > zipBufferedSizeLimit {
+		return 0
+	}
+
+	return ze.size
+}
+
+func (ze *zipEntry) compress(level int, spillDir string) {
+	if !ze.header.Mode().IsRegular() {
+		return
+	}
+
+	if ze.size > zipBufferedSizeLimit {
+		ze.err = ze.spill(level, spillDir)
+
+		return
+	}
+
+	raw, err := os.ReadFile(ze.path)
+
+	if err != nil {
+		ze.err = err
+
+		return
+	}
+
+	if ze.header.Method == zip.Store {
+		ze.setData(raw)
+
+		return
+	}
+
+	var buf bytes.Buffer
+
+	fw, err := flate.NewWriter(&buf, level)
+
+	if err == nil {
+		_, err = fw.Write(raw)
+	}
+
+	if err == nil {
+		err = fw.Close()
+	}
+
+	if err != nil {
+		ze.err = err
+
+		return
+	}
+
+	ze.data = buf.Bytes()
+	ze.header.CRC32 = crc32.ChecksumIEEE(raw)
+	ze.header.CompressedSize64 = uint64(len(ze.data))
+	ze.header.UncompressedSize64 = uint64(len(raw))
+}
+
+func (ze *zipEntry) setData(data []byte) {
+	ze.data = data
+	ze.header.CRC32 = crc32.ChecksumIEEE(data)
+	ze.header.CompressedSize64 = uint64(len(data))
+	ze.header.UncompressedSize64 = uint64(len(data))
+}
+
+// Deflates a file too large to buffer into a temporary file, or only
+// checksums it when it is to be stored as-is.
+func (ze *zipEntry) spill(level int, spillDir string) error {
+	file, err := os.Open(ze.path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	crc := crc32.NewIEEE()
+
+	if ze.header.Method == zip.Store {
+		size, err := io.Copy(crc, file)
 
 		if err != nil {
 			return err
 		}
 
-		_, err = io.Copy(zipEntry, file)
+		ze.header.CRC32 = crc.Sum32()
+		ze.header.CompressedSize64 = uint64(size)
+		ze.header.UncompressedSize64 = uint64(size)
+
+		return nil
+	}
+
+	spillFile, err := os.CreateTemp(spillDir, "entry-")
 
+	if err != nil {
 		return err
 	}
 
-	err = filepath.WalkDir(basePath, walker)
+	defer spillFile.Close()
 
-	err2 := zipWriter.Close()
+	ze.spillPath = spillFile.Name()
+
+	fw, err := flate.NewWriter(spillFile, level)
 
 	if err != nil {
 		return err
 	}
 
-	return err2
+	size, err := io.Copy(fw, io.TeeReader(file, crc))
+
+	if err == nil {
+		err = fw.Close()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	compressedSize, err := spillFile.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return err
+	}
+
+	ze.header.CRC32 = crc.Sum32()
+	ze.header.CompressedSize64 = uint64(compressedSize)
+	ze.header.UncompressedSize64 = uint64(size)
+
+	return nil
+}
+
+func (ze *zipEntry) write(zipWriter *zip.Writer) error {
+	if ze.err != nil {
+		return ze.err
+	}
+
+	writer, err := zipWriter.CreateRaw(ze.header)
+
+	if err != nil {
+		return err
+	}
+
+	if ze.size <= zipBufferedSizeLimit {
+		_, err = writer.Write(ze.data)
+
+		return err
+	}
+
+	srcPath := ze.path
+
+	if len(ze.spillPath) > 0 {
+		srcPath = ze.spillPath
+
+		defer os.Remove(srcPath) // free the disk space as soon as possible
+	}
+
+	file, err := os.Open(srcPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	// Copies no more than was checksummed, in case the file has grown since.
+	_, err = io.CopyN(writer, file, int64(ze.header.CompressedSize64))
+
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// Waits until the bytes fit within the window, letting a single entry through
+// whatever its size so that an oversized one cannot stall the archive.
+// Returns false once the window is closed.
+func (zw *zipWindow) acquire(size int64) bool {
+	zw.cond.L.Lock()
+
+	defer zw.cond.L.Unlock()
+
+	for !zw.closed && zw.used > 0 && zw.used+size > zw.limit {
+		zw.cond.Wait()
+	}
+
+	if zw.closed {
+		return false
+	}
+
+	zw.used += size
+
+	return true
+}
+
+func (zw *zipWindow) close() {
+	zw.cond.L.Lock()
+
+	defer zw.cond.L.Unlock()
+
+	zw.closed = true
+
+	zw.cond.Broadcast()
+}
+
+func (zw *zipWindow) release(size int64) {
+	zw.cond.L.Lock()
+
+	defer zw.cond.L.Unlock()
+
+	zw.used -= size
+
+	zw.cond.Broadcast()
+}
+
+//-----------------------------------------------------------------------------
+
+func isCompressedFile(path string) bool {
+	return slices.Contains(compressedFileExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// Makes entries reproducible across machines and checkouts: timestamps are
+// pinned to the zip epoch, no extra fields are written, only the executable
+// bit survives of the permissions, and directories are empty whatever size
+// their filesystem reports for them.
+func normalizeZipHeader(fh *zip.FileHeader) {
+	mode := fh.Mode()
+
+	switch {
+	case mode.IsDir():
+		fh.SetMode(fs.ModeDir | 0755)
+
+		fh.CRC32 = 0
+		fh.CompressedSize = 0
+		fh.CompressedSize64 = 0
+		fh.Method = zip.Store
+		fh.UncompressedSize = 0
+		fh.UncompressedSize64 = 0
+
+	case mode&fs.ModeSymlink != 0:
+		fh.SetMode(fs.ModeSymlink | 0777)
+
+	case mode&0111 != 0:
+		fh.SetMode(0755)
+
+	default:
+		fh.SetMode(0644)
+	}
+
+	fh.Extra = nil
+	fh.Flags |= zipUTF8Flag
+	fh.Modified = time.Time{}
+	fh.ModifiedDate = zipEpochDate
+	fh.ModifiedTime = 0
 }
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A directory as different filesystems describe it.
+type testDirInfo struct {
+	modTime time.Time
+	size    int64
+}
+
+func (tdi testDirInfo) IsDir() bool        { return true }
+func (tdi testDirInfo) ModTime() time.Time { return tdi.modTime }
+func (tdi testDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0700 }
+func (tdi testDirInfo) Name() string       { return "Example.app" }
+func (tdi testDirInfo) Size() int64        { return tdi.size }
+func (tdi testDirInfo) Sys() any           { return nil }
+
+func writeTestAppFolder(t *testing.T) (string, []string) {
+	appPath := filepath.Join(t.TempDir(), "Example.app")
+
+	var names []string
+
+	for idx := range 50 {
+		name := fmt.Sprintf("Example.app/Resources/file%02d.txt", idx)
+
+		if idx%10 == 0 {
+			name = fmt.Sprintf("Example.app/Images/image%02d.png", idx)
+		}
+
+		path := filepath.Join(filepath.Dir(appPath), filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(strings.Repeat(name, 100)), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return appPath, names
+}
+
+func zipTestAppFolder(t *testing.T, appPath string, level int) *zip.ReadCloser {
+	zipPath := filepath.Join(t.TempDir(), "Example.app.zip")
+
+	if err := zipFolder(zipPath, filepath.Dir(appPath), filepath.Base(appPath), level); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(zipPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { zr.Close() })
+
+	return zr
+}
+
+//-----------------------------------------------------------------------------
+
+func TestZipFolder(t *testing.T) {
+	appPath, names := writeTestAppFolder(t)
+
+	zr := zipTestAppFolder(t, appPath, defaultCompressionLevel)
+
+	var zipNames []string
+
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		zipNames = append(zipNames, file.Name)
+
+		data, err := readZipFile(file)
+
+		if err != nil {
+			t.Fatalf("Unable to read %q: %v", file.Name, err)
+		}
+
+		if string(data) != strings.Repeat(file.Name, 100) {
+			t.Errorf("Unexpected contents for %q", file.Name)
+		}
+
+		expected := zip.Deflate
+
+		if strings.HasSuffix(file.Name, ".png") {
+			expected = zip.Store
+		}
+
+		if file.Method != expected {
+			t.Errorf("Expected method %d for %q, got %d", expected, file.Name, file.Method)
+		}
+	}
+
+	if !slices.Equal(zipNames, names) {
+		t.Errorf("Expected entries %q, got %q", names, zipNames)
+	}
+}
+
+func TestZipFolderStoreOnly(t *testing.T) {
+	appPath, _ := writeTestAppFolder(t)
+
+	for _, file := range zipTestAppFolder(t, appPath, 0).File {
+		if !file.FileInfo().IsDir() && file.Method != zip.Store {
+			t.Errorf("Expected %q to be stored", file.Name)
+		}
+	}
+}
+
+func TestZipFolderPreservesLinksAndModes(t *testing.T) {
+	appPath, _ := writeTestAppFolder(t)
+	frameworkPath := filepath.Join(appPath, "Frameworks", "Example.framework")
+
+	if err := os.MkdirAll(filepath.Join(frameworkPath, "Versions", "A"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(frameworkPath, "Versions", "A", "Example"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("A", filepath.Join(frameworkPath, "Versions", "Current")); err != nil {
+		t.Fatal(err)
+	}
+
+	cwd, _ := os.Getwd()
+
+	zr := zipTestAppFolder(t, appPath, defaultCompressionLevel)
+
+	if wd, _ := os.Getwd(); wd != cwd {
+		t.Errorf("Working directory changed to %q", wd)
+	}
+
+	files := map[string]*zip.File{}
+
+	for _, file := range zr.File {
+		if file.Flags&zipUTF8Flag == 0 {
+			t.Errorf("Expected UTF-8 flag on %q", file.Name)
+		}
+
+		files[file.Name] = file
+	}
+
+	binary := files["Example.app/Frameworks/Example.framework/Versions/A/Example"]
+
+	if binary == nil || binary.Mode().Perm() != 0755 {
+		t.Error("Expected executable to keep its mode bits")
+	}
+
+	link := files["Example.app/Frameworks/Example.framework/Versions/Current"]
+
+	if link == nil || link.Mode()&fs.ModeSymlink == 0 {
+		t.Fatal("Expected Versions/Current to be stored as a symlink")
+	}
+
+	if target, _ := readZipFile(link); string(target) != "A" {
+		t.Errorf("Expected symlink to target %q, got %q", "A", target)
+	}
+
+	if files["Example.app/Frameworks/Example.framework/Versions/Current/Example"] != nil {
+		t.Error("Symlinked folder should not be followed")
+	}
+}
+
+func TestNormalizeZipHeaderDirectory(t *testing.T) {
+	var headers []*zip.FileHeader
+
+	// ext4 reports directories as multiples of 4096 bytes, APFS by entry count.
+	for _, tdi := range []testDirInfo{{time.Now(), 4096}, {time.Now().Add(time.Hour), 96}} {
+		fh, err := zip.FileInfoHeader(tdi)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		normalizeZipHeader(fh)
+
+		headers = append(headers, fh)
+	}
+
+	if !reflect.DeepEqual(headers[0], headers[1]) {
+		t.Errorf("Expected identical directory headers, got %+v and %+v", headers[0], headers[1])
+	}
+
+	if fh := headers[0]; fh.UncompressedSize64 != 0 || fh.CompressedSize64 != 0 || fh.Method != zip.Store {
+		t.Errorf("Expected empty stored directory, got %+v", fh)
+	}
+}
+
+func TestZipFolderDirectoriesAreEmpty(t *testing.T) {
+	appPath, _ := writeTestAppFolder(t)
+
+	dirs := 0
+
+	for _, file := range zipTestAppFolder(t, appPath, defaultCompressionLevel).File {
+		if !file.FileInfo().IsDir() {
+			continue
+		}
+
+		dirs++
+
+		if file.Method != zip.Store || file.CRC32 != 0 || file.CompressedSize64 != 0 || file.UncompressedSize64 != 0 {
+			t.Errorf("Expected %q to be an empty stored entry, got method %d, CRC %x, sizes %d/%d",
+				file.Name, file.Method, file.CRC32, file.CompressedSize64, file.UncompressedSize64)
+		}
+	}
+
+	if dirs == 0 {
+		t.Error("Expected directory entries")
+	}
+}
+
+func TestZipFolderIsReproducible(t *testing.T) {
+	appPath, names := writeTestAppFolder(t)
+
+	digest := func() string {
+		zipPath := filepath.Join(t.TempDir(), "Example.app.zip")
+
+		if err := zipFolder(zipPath, filepath.Dir(appPath), filepath.Base(appPath), defaultCompressionLevel); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(zipPath)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return testSHA256(data)
+	}
+
+	first := digest()
+
+	// Another checkout of the same build has other mtimes and umask.
+	later := time.Now().Add(time.Hour)
+
+	for _, name := range names {
+		path := filepath.Join(filepath.Dir(appPath), filepath.FromSlash(name))
+
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chmod(path, 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if second := digest(); second != first {
+		t.Errorf("Expected identical payloads, got %s and %s", first, second)
+	}
+}
+
+func TestZipFolderLargeFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Setenv("TMPDIR", tmpDir)
+
+	appPath, _ := writeTestAppFolder(t)
+
+	large := map[string][]byte{
+		"Example.app/Resources/large.bin": []byte(strings.Repeat("large file ", zipBufferedSizeLimit/10)),
+		"Example.app/Images/large.png":    []byte(strings.Repeat("large image ", zipBufferedSizeLimit/11))}
+
+	for name, data := range large {
+		path := filepath.Join(filepath.Dir(appPath), filepath.FromSlash(name))
+
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	zr := zipTestAppFolder(t, appPath, defaultCompressionLevel)
+
+	for name, expected := range large {
+		file := findZipFile(&zr.Reader, name)
+
+		if file == nil {
+			t.Fatalf("Expected entry %q", name)
+		}
+
+		data, err := readZipFile(file)
+
+		if err != nil {
+			t.Fatalf("Unable to read %q: %v", name, err)
+		}
+
+		if !slices.Equal(data, expected) {
+			t.Errorf("Unexpected contents for %q", name)
+		}
+
+		method := zip.Deflate
+
+		if strings.HasSuffix(name, ".png") {
+			method = zip.Store
+		}
+
+		if file.Method != method {
+			t.Errorf("Expected method %d for %q, got %d", method, name, file.Method)
+		}
+	}
+
+	if leftovers, _ := filepath.Glob(filepath.Join(tmpDir, "waldo-zip-*")); len(leftovers) > 0 {
+		t.Errorf("Expected no spill folder left behind, got %q", leftovers)
+	}
+}
+
+func TestZipWindow(t *testing.T) {
+	zw := newZipWindow(10)
+
+	if !zw.acquire(8) || !zw.acquire(2) {
+		t.Fatal("Expected sizes within the window to be acquired")
+	}
+
+	acquired := make(chan bool)
+
+	go func() { acquired <- zw.acquire(5) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("Expected acquire to wait for room in the window")
+
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	zw.release(8)
+
+	if !<-acquired {
+		t.Fatal("Expected acquire to succeed once room was released")
+	}
+
+	zw.release(7)
+
+	if !zw.acquire(100) {
+		t.Error("Expected an oversized entry to be let through an empty window")
+	}
+
+	zw.close()
+
+	if zw.acquire(1) {
+		t.Error("Expected acquire to fail on a closed window")
+	}
+}